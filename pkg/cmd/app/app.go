@@ -4,19 +4,26 @@ import (
 	"context"
 	"fmt"
 	"github.com/spf13/cobra"
+	appcorev1 "github.com/warm-metal/cliapp/pkg/apis/cliapp/v1"
 	appv1 "github.com/warm-metal/cliapp/pkg/clientset/versioned"
 	"github.com/warm-metal/cliapp/pkg/libcli"
 	"github.com/warm-metal/kubectl-dev/pkg/cmd/opts"
+	"github.com/warm-metal/kubectl-dev/pkg/session"
+	"github.com/warm-metal/kubectl-dev/pkg/utils"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 	"k8s.io/cli-runtime/pkg/genericclioptions"
+	"k8s.io/client-go/util/exec"
 )
 
 type AppOptions struct {
 	*opts.GlobalOptions
 	genericclioptions.IOStreams
 
-	name      string
-	namespace string
+	name        string
+	namespace   string
+	record      string
+	recordInput bool
+	workdir     string
 
 	args []string
 	cmd  *cobra.Command
@@ -33,7 +40,11 @@ func (o *AppOptions) Complete(cmd *cobra.Command, args []string) error {
 }
 
 func (o *AppOptions) Validate() error {
-	return nil
+	if o.recordInput && len(o.record) == 0 {
+		return fmt.Errorf("--record-input requires --record")
+	}
+
+	return validateWorkdirMode(o.workdir)
 }
 
 func (o *AppOptions) Run(ctx context.Context) error {
@@ -52,6 +63,26 @@ func (o *AppOptions) Run(ctx context.Context) error {
 		return err
 	}
 
+	workdir := o.workdir
+	if len(workdir) == 0 {
+		workdir = app.Annotations[workdirAnnotation]
+	}
+
+	if workdir == workdirPush || workdir == workdirSync {
+		if len(o.record) > 0 {
+			return fmt.Errorf("sessions sharing the working directory can't be recorded")
+		}
+
+		return o.silenceExitError(o.runInWorkdir(ctx, appClient, app, workdir))
+	}
+
+	// The gate always allocates a TTY, which mangles piped data and merges stderr into stdout.
+	if len(o.record) == 0 && !(utils.IsTerminal(o.In) && utils.IsTerminal(o.Out)) {
+		return o.silenceExitError(o.runLive(ctx, appClient, app, func(app *appcorev1.CliApp) error {
+			return o.execApp(app, "", o.appCommand(app))
+		}))
+	}
+
 	clientset, err := o.ClientSet()
 	if err != nil {
 		return err
@@ -62,13 +93,31 @@ func (o *AppOptions) Run(ctx context.Context) error {
 		return err
 	}
 
-	o.cmd.SilenceErrors = true
-	err = libcli.ExecCliApp(ctx, endpoints, app, o.args, o.In, o.Out)
-	if err != nil {
+	var recorder *session.Recorder
+	if len(o.record) > 0 {
+		if recorder, err = session.NewRecorder(utils.ExpandTilde(o.record), app.Name, o.recordInput); err != nil {
+			return err
+		}
+
+		defer recorder.Close()
+	}
+
+	err = session.Exec(ctx, endpoints, app, o.args, o.In, o.Out, session.WithRecorder(recorder))
+	if _, exited := err.(exec.CodeExitError); !exited && err != nil {
 		return fmt.Errorf("unable to open app shell: %s", err)
 	}
 
-	return nil
+	return o.silenceExitError(err)
+}
+
+// silenceExitError prevents the error from being printed if the remote command fails,
+// such that only its exit code is passed to the caller.
+func (o *AppOptions) silenceExitError(err error) error {
+	if _, exited := err.(exec.CodeExitError); exited {
+		o.cmd.SilenceErrors = true
+	}
+
+	return err
 }
 
 func NewCmd(opts *opts.GlobalOptions, streams genericclioptions.IOStreams) *cobra.Command {
@@ -82,9 +131,20 @@ func NewCmd(opts *opts.GlobalOptions, streams genericclioptions.IOStreams) *cobr
 		Short: "Run a CliApp.",
 		Long: `CliApp is a sort of command line apps which run in a K8s cluster but can be used as a local command.
 You usually don't this command directly since the "kubectl dev app install" command has installed a shortcut.
-Say cliapp "ctr", type "ctr i ls" in any shell context just like execute a local command.`,
+Say cliapp "ctr", type "ctr i ls" in any shell context just like execute a local command.
+
+Apps run in the cluster and can't see local files. With "--workdir push", the current directory is copied to the same
+path in the app Pod before the command starts in that path. With "--workdir sync", files created or changed by the
+command are also copied back once it exits. Only changed files are copied and files are never deleted on either side.
+The default mode can be set via "kubectl dev app install --workdir". A shell is required in the app image.`,
 		Example: `# Run ctr to list all images
 kubectl-dev app -n app --name ctr -- i ls
+
+# Record the session to an asciicast file
+kubectl-dev app -n app --name ctr --record ctr.cast -- i ls
+
+# Run terraform in the current directory and copy the state back
+kubectl-dev app -n app --name terraform --workdir sync -- plan -out plan.tfplan
 `,
 		SilenceUsage: true,
 		RunE: func(cmd *cobra.Command, args []string) error {
@@ -103,12 +163,27 @@ kubectl-dev app -n app --name ctr -- i ls
 	}
 
 	cmd.Flags().StringVar(&o.name, "name", "", "App name. A random name would be used if not set.")
+	cmd.Flags().StringVar(&o.record, "record", "",
+		"Record the session to the local file in the asciicast v2 format. Replay it via \"kubectl dev replay\".")
+	cmd.Flags().BoolVar(&o.recordInput, "record-input", false,
+		"Also record keys typed in the session, including passwords which are not echoed.")
+	cmd.Flags().StringVar(&o.workdir, "workdir", "",
+		"Share the local working directory with the app, one of none, push, or sync. "+
+			"The default is the one set while installing the app, or none.")
 	o.AddPersistentFlags(cmd.Flags())
 
 	cmd.AddCommand(
 		newAppInstallCmd(opts, streams),
 		newAppUninstallCmd(opts, streams),
 		newAppListCmd(opts, streams),
+		newAppApplyCmd(opts, streams),
+		newAppSearchCmd(opts, streams),
+		newAppMigrateCmd(opts, streams),
+		newAppCompletionCmd(opts, streams),
+		newAppUpgradeCmd(opts, streams),
+		newAppDoctorCmd(opts, streams),
+		newAppExportCmd(opts, streams),
+		newAppImportCmd(opts, streams),
 	)
 	return cmd
 }
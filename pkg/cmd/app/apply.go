@@ -0,0 +1,203 @@
+package app
+
+import (
+	"context"
+	"fmt"
+	"github.com/spf13/cobra"
+	appcorev1 "github.com/warm-metal/cliapp/pkg/apis/cliapp/v1"
+	appv1 "github.com/warm-metal/cliapp/pkg/clientset/versioned"
+	"github.com/warm-metal/kubectl-dev/pkg/cmd/opts"
+	"k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/labels"
+	"k8s.io/cli-runtime/pkg/genericclioptions"
+)
+
+type appApplyOptions struct {
+	*opts.GlobalOptions
+	genericclioptions.IOStreams
+	shortcutInstallOptions
+
+	file      string
+	namespace string
+	prune     bool
+
+	// pruneNamespace is the namespace where apps not in the manifest are pruned. Empty means all namespaces.
+	pruneNamespace string
+
+	apps []*appcorev1.CliApp
+}
+
+func (o *appApplyOptions) Complete(cmd *cobra.Command, args []string) error {
+	if len(args) > 0 {
+		cmd.SilenceUsage = false
+		return fmt.Errorf("invalid arguments")
+	}
+
+	if o.Raw().Namespace != nil && len(*o.Raw().Namespace) > 0 {
+		o.namespace = *o.Raw().Namespace
+		o.pruneNamespace = o.namespace
+	}
+
+	if len(o.file) == 0 {
+		cmd.SilenceUsage = false
+		return fmt.Errorf("a manifest is required")
+	}
+
+	manifest, err := loadManifest(o.file, o.In)
+	if err != nil {
+		return err
+	}
+
+	for i := range manifest.Apps {
+		app, err := manifest.Apps[i].toCliApp(o.namespace)
+		if err != nil {
+			return err
+		}
+
+		app.Labels = map[string]string{appliedLabel: "true"}
+		o.apps = append(o.apps, app)
+	}
+
+	return nil
+}
+
+func (o *appApplyOptions) Validate() error {
+	return validateUniqueNames(o.apps)
+}
+
+func (o *appApplyOptions) Run(ctx context.Context) error {
+	conf, err := o.Raw().ToRESTConfig()
+	if err != nil {
+		return err
+	}
+
+	appClient, err := appv1.NewForConfig(conf)
+	if err != nil {
+		return err
+	}
+
+	applied := make(map[string]string, len(o.apps))
+	for _, app := range o.apps {
+		result, err := o.applyApp(ctx, appClient, app, o.ErrOut)
+		if err != nil {
+			return err
+		}
+
+		applied[app.Name] = app.Namespace
+		fmt.Fprintf(o.Out, "cliapp %s/%s %s\n", app.Namespace, app.Name, result)
+	}
+
+	if err = o.shortcutInstallOptions.prepare(); err != nil {
+		return err
+	}
+
+	o.printPathHint(o.ErrOut)
+	if !o.prune {
+		return nil
+	}
+
+	apps, err := appClient.CliappV1().CliApps(o.pruneNamespace).List(ctx, metav1.ListOptions{
+		LabelSelector: labels.Set{appliedLabel: "true"}.AsSelector().String(),
+	})
+	if err != nil {
+		return err
+	}
+
+	for i := range apps.Items {
+		app := &apps.Items[i]
+		ns, found := applied[app.Name]
+		if found && ns == app.Namespace {
+			continue
+		}
+
+		err = appClient.CliappV1().CliApps(app.Namespace).Delete(ctx, app.Name, metav1.DeleteOptions{})
+		if err != nil && !errors.IsNotFound(err) {
+			return fmt.Errorf(`can't prune app "%s/%s": %s`, app.Namespace, app.Name, err)
+		}
+
+		// Keep the shortcut if it now belongs to the app of the same name in another namespace.
+		if !found {
+			shortcut := o.shortcutInstallOptions
+			if err = shortcut.init(app.Name); err != nil {
+				return err
+			}
+
+			if err = shortcut.uninstallShortcut(); err != nil {
+				return err
+			}
+
+			shortcut.warnLegacyShortcut(o.ErrOut, app.Name)
+		}
+
+		fmt.Fprintf(o.Out, "cliapp %s/%s pruned\n", app.Namespace, app.Name)
+	}
+
+	return nil
+}
+
+func newAppApplyCmd(opts *opts.GlobalOptions, streams genericclioptions.IOStreams) *cobra.Command {
+	o := &appApplyOptions{
+		GlobalOptions:          opts,
+		IOStreams:              streams,
+		namespace:              metav1.NamespaceDefault,
+		shortcutInstallOptions: initShortcutInstallOptions(),
+	}
+
+	var cmd = &cobra.Command{
+		Use:   "apply -f manifest",
+		Short: "Install or update CliApps declared in a manifest.",
+		Long: `Install or update all CliApps declared in a manifest, as well as their shortcuts.
+A manifest is a YAML file like below. All fields except the name are optional.
+The namespace is the one specified via "-n", or "default" if not set.
+
+apps:
+- name: ctr
+  namespace: default
+  image: docker.io/warmmetal/ctr:v1
+  dockerfile: ""
+  command: [ctr]
+  env: [CONTAINERD_NAMESPACE=k8s.io]
+  hostpaths: [/var/run/containerd/containerd.sock]
+  distro: alpine
+  shell: bash
+  useProxy: true
+  workdir: none
+
+Apps installed via "apply" are labeled. With "--prune", labeled apps which are no longer in the manifest are
+uninstalled, in the namespace specified via "-n", or in all namespaces if not set.`,
+		Example: `# Install or update all apps in apps.yaml
+kubectl dev app apply -f apps.yaml
+
+# Also uninstall apps that were applied before but have been removed from apps.yaml
+kubectl dev app apply -f apps.yaml --prune
+
+# Read the manifest from stdin
+cat apps.yaml | kubectl dev app apply -f -
+`,
+		SilenceUsage: true,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			if err := o.Complete(cmd, args); err != nil {
+				return err
+			}
+			if err := o.Validate(); err != nil {
+				return err
+			}
+			if err := o.Run(cmd.Context()); err != nil {
+				return err
+			}
+
+			return nil
+		},
+	}
+
+	cmd.Flags().StringVarP(&o.file, "filename", "f", "", "The manifest of apps. Use \"-\" to read it from stdin.")
+	cmd.Flags().BoolVar(&o.prune, "prune", false,
+		"If set, uninstall apps applied before but not in the manifest any more.")
+	cmd.Flags().StringVar(&o.shortcutRoot, "install-base", o.shortcutRoot,
+		"Directory where app shortcuts to be installed. It should be one of the PATH. "+
+			"The default value is $XDG_BIN_HOME, or ~/.local/bin if not set.")
+	o.AddPersistentFlags(cmd.Flags())
+
+	return cmd
+}
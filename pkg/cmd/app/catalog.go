@@ -0,0 +1,295 @@
+package app
+
+import (
+	"context"
+	"fmt"
+	"github.com/warm-metal/kubectl-dev/pkg/conf"
+	"github.com/warm-metal/kubectl-dev/pkg/utils"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"sigs.k8s.io/yaml"
+	"strings"
+	"time"
+)
+
+const (
+	// catalogConfFile is the local configuration in which default catalog sources are listed.
+	catalogConfFile = "catalog"
+
+	// catalogIndexFile is the index file in the root of catalog directories or git repositories.
+	catalogIndexFile = "catalog.yaml"
+
+	// fetchTimeout limits the time fetching catalogs and Dockerfiles.
+	fetchTimeout = 30 * time.Second
+)
+
+type catalogConf struct {
+	Sources []string `yaml:"sources"`
+}
+
+// catalogEntry is an app recipe in a catalog.
+type catalogEntry struct {
+	appDefinition
+	Description string `json:"description,omitempty"`
+}
+
+type catalogIndex struct {
+	Apps []catalogEntry `json:"apps"`
+}
+
+// catalog is a loaded catalog index.
+// Relative Dockerfile paths in the index are resolved against base, a URL or a local directory.
+type catalog struct {
+	source string
+	base   string
+	remote bool
+	catalogIndex
+
+	// dockerfiles caches contents of local Dockerfiles, keyed by their paths in the index.
+	dockerfiles map[string]string
+}
+
+// loadCatalogSources returns the sources if not empty, or the default sources in the local configuration.
+func loadCatalogSources(sources []string) ([]string, error) {
+	if len(sources) > 0 {
+		return sources, nil
+	}
+
+	c := catalogConf{}
+	if err := conf.Load(catalogConfFile, &c); err != nil && !os.IsNotExist(err) {
+		return nil, fmt.Errorf("unable to load catalog sources: %s", err)
+	}
+
+	if len(c.Sources) == 0 {
+		return nil, fmt.Errorf(
+			`no catalog found. Specify one via "--catalog" or list them in "~/.kubectl-dev/%s"`, catalogConfFile)
+	}
+
+	return c.Sources, nil
+}
+
+// loadCatalog fetches the catalog index from a local file or directory, an HTTP URL, or a git repository.
+// Git repositories are in the form "git+<url>[#ref]", or any URL ending with ".git".
+func loadCatalog(ctx context.Context, source string) (*catalog, error) {
+	if repo, ref, isGit := parseGitSource(source); isGit {
+		return loadGitCatalog(ctx, source, repo, ref)
+	}
+
+	if strings.HasPrefix(source, "http://") || strings.HasPrefix(source, "https://") {
+		return loadHTTPCatalog(ctx, source)
+	}
+
+	return loadLocalCatalog(source, utils.ExpandTilde(source))
+}
+
+func parseGitSource(source string) (repo, ref string, isGit bool) {
+	repo = source
+	if i := strings.LastIndex(repo, "#"); i > 0 {
+		repo, ref = repo[:i], repo[i+1:]
+	}
+
+	if strings.HasPrefix(repo, "git+") {
+		return strings.TrimPrefix(repo, "git+"), ref, true
+	}
+
+	if strings.HasSuffix(repo, ".git") {
+		return repo, ref, true
+	}
+
+	return source, "", false
+}
+
+func loadGitCatalog(ctx context.Context, source, repo, ref string) (*catalog, error) {
+	dir, err := ioutil.TempDir("", "kubectl-dev-catalog-")
+	if err != nil {
+		return nil, err
+	}
+
+	defer os.RemoveAll(dir)
+
+	ctx, cancel := context.WithTimeout(ctx, fetchTimeout)
+	defer cancel()
+
+	args := []string{"clone", "-q", "--depth", "1"}
+	if len(ref) > 0 {
+		args = append(args, "--branch", ref)
+	}
+
+	args = append(args, repo, dir)
+	out, err := exec.CommandContext(ctx, "git", args...).CombinedOutput()
+	if err != nil {
+		return nil, fmt.Errorf(`can't clone catalog "%s": %s: %s`, source, err, strings.TrimSpace(string(out)))
+	}
+
+	c, err := loadLocalCatalog(source, dir)
+	if err != nil {
+		return nil, err
+	}
+
+	// Files in the repository are removed once returned, so read Dockerfiles right now.
+	c.dockerfiles = make(map[string]string)
+	for i := range c.Apps {
+		dockerfile := c.Apps[i].Dockerfile
+		if c.dockerfiles[dockerfile], err = c.resolveDockerfile(dockerfile); err != nil {
+			return nil, err
+		}
+	}
+
+	return c, nil
+}
+
+func loadHTTPCatalog(ctx context.Context, source string) (*catalog, error) {
+	bytes, err := fetchURL(ctx, source)
+	if err != nil {
+		return nil, fmt.Errorf(`can't fetch catalog "%s": %s`, source, err)
+	}
+
+	return parseCatalog(source, source, true, bytes)
+}
+
+// fetchURL returns the content at the HTTP URL.
+func fetchURL(ctx context.Context, url string) ([]byte, error) {
+	ctx, cancel := context.WithTimeout(ctx, fetchTimeout)
+	defer cancel()
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, url, nil)
+	if err != nil {
+		return nil, err
+	}
+
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return nil, err
+	}
+
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("%s", resp.Status)
+	}
+
+	return ioutil.ReadAll(resp.Body)
+}
+
+func loadLocalCatalog(source, path string) (*catalog, error) {
+	fi, err := os.Stat(path)
+	if err != nil {
+		return nil, fmt.Errorf(`can't open catalog "%s": %s`, source, err)
+	}
+
+	base := filepath.Dir(path)
+	if fi.IsDir() {
+		base = path
+		path = filepath.Join(path, catalogIndexFile)
+	}
+
+	bytes, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf(`can't open catalog "%s": %s`, source, err)
+	}
+
+	return parseCatalog(source, base, false, bytes)
+}
+
+func parseCatalog(source, base string, remote bool, bytes []byte) (*catalog, error) {
+	c := &catalog{source: source, base: base, remote: remote}
+	if err := yaml.UnmarshalStrict(bytes, &c.catalogIndex); err != nil {
+		return nil, fmt.Errorf(`invalid catalog "%s": %s`, source, err)
+	}
+
+	for i := range c.Apps {
+		if len(c.Apps[i].Name) == 0 {
+			return nil, fmt.Errorf(`invalid catalog "%s": the name of app #%d is empty`, source, i)
+		}
+	}
+
+	return c, nil
+}
+
+// resolveDockerfile converts a Dockerfile path relative to the catalog to an absolute URL for remote catalogs,
+// or to its content for local catalogs. URLs and Dockerfile contents are returned untouched.
+func (c *catalog) resolveDockerfile(dockerfile string) (string, error) {
+	if len(dockerfile) == 0 || strings.Contains(dockerfile, "\n") ||
+		strings.HasPrefix(dockerfile, "http://") || strings.HasPrefix(dockerfile, "https://") {
+		return dockerfile, nil
+	}
+
+	if c.remote {
+		base, err := url.Parse(c.base)
+		if err != nil {
+			return "", err
+		}
+
+		ref, err := url.Parse(dockerfile)
+		if err != nil {
+			return "", fmt.Errorf(`invalid Dockerfile "%s" in catalog "%s": %s`, dockerfile, c.source, err)
+		}
+
+		return base.ResolveReference(ref).String(), nil
+	}
+
+	if content, found := c.dockerfiles[dockerfile]; found {
+		return content, nil
+	}
+
+	path := dockerfile
+	if !filepath.IsAbs(path) {
+		path = filepath.Join(c.base, path)
+	}
+
+	bytes, err := ioutil.ReadFile(path)
+	if err != nil {
+		return "", fmt.Errorf(`can't read Dockerfile "%s" in catalog "%s": %s`, dockerfile, c.source, err)
+	}
+
+	return string(bytes), nil
+}
+
+// lookup returns the definition of the named app, or nil if not found.
+func (c *catalog) lookup(name string) (*appDefinition, error) {
+	for i := range c.Apps {
+		if c.Apps[i].Name != name {
+			continue
+		}
+
+		def := c.Apps[i].appDefinition
+		dockerfile, err := c.resolveDockerfile(def.Dockerfile)
+		if err != nil {
+			return nil, err
+		}
+
+		def.Dockerfile = dockerfile
+		return &def, nil
+	}
+
+	return nil, nil
+}
+
+// lookupCatalogApp searches sources in order and returns the first app of the name.
+func lookupCatalogApp(ctx context.Context, sources []string, name string) (*appDefinition, error) {
+	sources, err := loadCatalogSources(sources)
+	if err != nil {
+		return nil, err
+	}
+
+	for _, source := range sources {
+		c, err := loadCatalog(ctx, source)
+		if err != nil {
+			return nil, err
+		}
+
+		def, err := c.lookup(name)
+		if err != nil {
+			return nil, err
+		}
+
+		if def != nil {
+			return def, nil
+		}
+	}
+
+	return nil, fmt.Errorf(`app "%s" not found in catalogs %v`, name, sources)
+}
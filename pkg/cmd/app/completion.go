@@ -0,0 +1,250 @@
+package app
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"github.com/spf13/cobra"
+	appcorev1 "github.com/warm-metal/cliapp/pkg/apis/cliapp/v1"
+	appv1 "github.com/warm-metal/cliapp/pkg/clientset/versioned"
+	"github.com/warm-metal/kubectl-dev/pkg/cmd/opts"
+	"github.com/warm-metal/kubectl-dev/pkg/utils"
+	"io/ioutil"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/cli-runtime/pkg/genericclioptions"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+const (
+	completionBash = "bash"
+	completionZsh  = "zsh"
+	completionFish = "fish"
+)
+
+// completionPath returns where the completion script of the app is installed.
+// Scripts for fish are installed to its completion directory and loaded automatically.
+func (o *shortcutInstallOptions) completionPath(shell, app string) string {
+	switch shell {
+	case completionBash:
+		return filepath.Join(o.appRoot, "completion", completionBash, app)
+	case completionZsh:
+		return filepath.Join(o.appRoot, "completion", completionZsh, "_"+app)
+	case completionFish:
+		configHome := os.Getenv("XDG_CONFIG_HOME")
+		if len(configHome) == 0 {
+			configHome = utils.ExpandTilde("~/.config")
+		}
+
+		return filepath.Join(configHome, "fish", "completions", app+".fish")
+	default:
+		panic(shell)
+	}
+}
+
+// removeCompletions removes completion scripts of the app for all shells.
+func (o *shortcutInstallOptions) removeCompletions(app string) error {
+	for _, shell := range []string{completionBash, completionZsh, completionFish} {
+		if err := os.Remove(o.completionPath(shell, app)); err != nil && !os.IsNotExist(err) {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// replaceCommandName replaces the command name in the script with the new one, except those in other words,
+// e.g., function names "__start_crictl".
+func replaceCommandName(script, name, newName string) string {
+	isWordChar := func(c byte) bool {
+		return c == '_' || c == '-' || ('0' <= c && c <= '9') || ('a' <= c && c <= 'z') || ('A' <= c && c <= 'Z')
+	}
+
+	var b strings.Builder
+	for {
+		i := strings.Index(script, name)
+		if i < 0 {
+			b.WriteString(script)
+			return b.String()
+		}
+
+		end := i + len(name)
+		if (i > 0 && isWordChar(script[i-1])) || (end < len(script) && isWordChar(script[end])) {
+			b.WriteString(script[:end])
+		} else {
+			b.WriteString(script[:i])
+			b.WriteString(newName)
+		}
+
+		script = script[end:]
+	}
+}
+
+type appCompletionOptions struct {
+	*opts.GlobalOptions
+	genericclioptions.IOStreams
+	shortcutInstallOptions
+
+	name      string
+	namespace string
+	shell     string
+	command   []string
+	print     bool
+}
+
+func (o *appCompletionOptions) Complete(cmd *cobra.Command, args []string) error {
+	if o.Raw().Namespace != nil && len(*o.Raw().Namespace) > 0 {
+		o.namespace = *o.Raw().Namespace
+	}
+
+	if dash := cmd.ArgsLenAtDash(); dash >= 0 {
+		o.command = args[dash:]
+		args = args[:dash]
+	}
+
+	if len(args) != 2 {
+		cmd.SilenceUsage = false
+		return fmt.Errorf("both the app name and the shell are required")
+	}
+
+	o.name, o.shell = args[0], args[1]
+	if o.print {
+		return nil
+	}
+
+	return o.shortcutInstallOptions.init(o.name)
+}
+
+func (o *appCompletionOptions) Validate() error {
+	switch o.shell {
+	case completionBash, completionZsh, completionFish:
+		return nil
+	default:
+		return fmt.Errorf("shell must be one of %s, %s, or %s", completionBash, completionZsh, completionFish)
+	}
+}
+
+func (o *appCompletionOptions) Run(ctx context.Context) error {
+	conf, err := o.Raw().ToRESTConfig()
+	if err != nil {
+		return err
+	}
+
+	appClient, err := appv1.NewForConfig(conf)
+	if err != nil {
+		return err
+	}
+
+	app, err := appClient.CliappV1().CliApps(o.namespace).Get(ctx, o.name, metav1.GetOptions{})
+	if err != nil {
+		return err
+	}
+
+	command := o.command
+	if len(command) == 0 {
+		if len(app.Spec.Command) == 0 {
+			return fmt.Errorf(`app "%s" has no command. Specify the command generating the script after "--"`, o.name)
+		}
+
+		command = append(append([]string(nil), app.Spec.Command...), "completion", o.shell)
+	}
+
+	var script bytes.Buffer
+	runner := &AppOptions{
+		GlobalOptions: o.GlobalOptions,
+		IOStreams:     genericclioptions.IOStreams{In: strings.NewReader(""), Out: &script, ErrOut: o.ErrOut},
+	}
+
+	err = runner.runLive(ctx, appClient, app, func(app *appcorev1.CliApp) error {
+		return runner.execApp(app, "", command)
+	})
+	if err != nil {
+		return fmt.Errorf(`unable to generate the completion script via "%s": %s`, strings.Join(command, " "), err)
+	}
+
+	if script.Len() == 0 {
+		return fmt.Errorf(`"%s" generates nothing`, strings.Join(command, " "))
+	}
+
+	// Completion functions call the command of the app, which is the shortcut named after the app locally.
+	// The command generating the script may be a different one, like a shell wrapping the app.
+	name := command[0]
+	if len(app.Spec.Command) > 0 {
+		name = app.Spec.Command[0]
+	}
+
+	content := replaceCommandName(script.String(), filepath.Base(name), o.name)
+	if o.print {
+		_, err = fmt.Fprint(o.Out, content)
+		return err
+	}
+
+	path := o.completionPath(o.shell, o.name)
+	if err = mkdirAll(filepath.Dir(path)); err != nil {
+		return err
+	}
+
+	if err = ioutil.WriteFile(path, []byte(content), 0644); err != nil {
+		return err
+	}
+
+	if err = chownToSudoer(path); err != nil {
+		return err
+	}
+
+	fmt.Fprintf(o.Out, "Installed %s\n", path)
+	switch o.shell {
+	case completionBash:
+		fmt.Fprintf(o.Out, "To load completions of all apps, add the line below to ~/.bashrc once.\n\n"+
+			"    for f in %s/*; do source \"$f\"; done\n\n", filepath.Dir(path))
+	case completionZsh:
+		fmt.Fprintf(o.Out, "To load completions of all apps, add the line below to ~/.zshrc once, before compinit.\n\n"+
+			"    fpath=(%s $fpath)\n\n", filepath.Dir(path))
+	}
+
+	return nil
+}
+
+func newAppCompletionCmd(opts *opts.GlobalOptions, streams genericclioptions.IOStreams) *cobra.Command {
+	o := &appCompletionOptions{
+		GlobalOptions:          opts,
+		IOStreams:              streams,
+		namespace:              metav1.NamespaceDefault,
+		shortcutInstallOptions: initShortcutInstallOptions(),
+	}
+
+	var cmd = &cobra.Command{
+		Use:   "completion [OPTIONS] name bash|zsh|fish [-- command]",
+		Short: "Install the shell completion script of a CliApp.",
+		Long: `Generate the completion script of a CliApp in the cluster, then install it along with the shortcut.
+The script is generated via "<app command> completion <shell>" in the app by default.
+Specify the command after "--" if the app has a different one.
+Occurrences of the app command in the script are replaced with the shortcut name.
+The script is uninstalled along with the app.`,
+		Example: `# Install the bash completion script of crictl
+kubectl dev app completion crictl bash
+
+# Generate the zsh completion script via a different command and print it
+kubectl dev app completion gh zsh --print -- gh completion -s zsh
+`,
+		SilenceUsage: true,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			if err := o.Complete(cmd, args); err != nil {
+				return err
+			}
+			if err := o.Validate(); err != nil {
+				return err
+			}
+			if err := o.Run(cmd.Context()); err != nil {
+				return err
+			}
+
+			return nil
+		},
+	}
+
+	cmd.Flags().BoolVar(&o.print, "print", false, "If set, print the script instead of installing it.")
+	o.AddPersistentFlags(cmd.Flags())
+	return cmd
+}
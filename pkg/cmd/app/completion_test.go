@@ -0,0 +1,57 @@
+package app
+
+import "testing"
+
+func TestReplaceCommandName(t *testing.T) {
+	tests := []struct {
+		name    string
+		script  string
+		command string
+		newName string
+		want    string
+	}{
+		{
+			name:    "command and functions",
+			script:  "_kubectl_completion() {\n  kubectl __complete\n}\ncomplete -F _kubectl_completion kubectl\n",
+			command: "kubectl",
+			newName: "k",
+			want:    "_kubectl_completion() {\n  k __complete\n}\ncomplete -F _kubectl_completion k\n",
+		},
+		{
+			name:    "names containing the command",
+			script:  "complete -c ctr2 -a ctr-foo; complete -c ctr",
+			command: "ctr",
+			newName: "myctr",
+			want:    "complete -c ctr2 -a ctr-foo; complete -c myctr",
+		},
+		{
+			name:    "quoted and in paths",
+			script:  `compdef _ctr ctr; "ctr" /usr/bin/ctr`,
+			command: "ctr",
+			newName: "c",
+			want:    `compdef _ctr c; "c" /usr/bin/c`,
+		},
+		{
+			name:    "same name",
+			script:  "complete -F _helm helm",
+			command: "helm",
+			newName: "helm",
+			want:    "complete -F _helm helm",
+		},
+		{
+			name:    "not found",
+			script:  "complete -F _helm helm",
+			command: "kubectl",
+			newName: "k",
+			want:    "complete -F _helm helm",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := replaceCommandName(tt.script, tt.command, tt.newName); got != tt.want {
+				t.Errorf("replaceCommandName() = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
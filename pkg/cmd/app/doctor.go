@@ -0,0 +1,541 @@
+package app
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"github.com/spf13/cobra"
+	appcorev1 "github.com/warm-metal/cliapp/pkg/apis/cliapp/v1"
+	appv1 "github.com/warm-metal/cliapp/pkg/clientset/versioned"
+	"github.com/warm-metal/cliapp/pkg/libcli"
+	"github.com/warm-metal/kubectl-dev/pkg/cmd/opts"
+	"github.com/warm-metal/kubectl-dev/pkg/diagnose"
+	"github.com/warm-metal/kubectl-dev/pkg/utils"
+	"io"
+	"io/ioutil"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/fields"
+	"k8s.io/apimachinery/pkg/labels"
+	"k8s.io/cli-runtime/pkg/genericclioptions"
+	"k8s.io/client-go/kubernetes"
+	"net"
+	"net/url"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+const (
+	cliappNamespace = "cliapp-system"
+
+	// appPodLabel is the label of app Pods, whose value is the app name.
+	appPodLabel = "cliapp.warm-metal.tech"
+
+	gateDialTimeout = 3 * time.Second
+
+	// longBuildDuration is the duration after which a build is considered stuck.
+	longBuildDuration = 10 * time.Minute
+)
+
+// doctorReport prints results of checks along with remediation hints.
+type doctorReport struct {
+	out      io.Writer
+	failures int
+}
+
+func (r *doctorReport) pass(format string, a ...interface{}) {
+	fmt.Fprintf(r.out, "[PASS] %s\n", fmt.Sprintf(format, a...))
+}
+
+func (r *doctorReport) warn(hint, format string, a ...interface{}) {
+	fmt.Fprintf(r.out, "[WARN] %s\n", fmt.Sprintf(format, a...))
+	r.hint(hint)
+}
+
+func (r *doctorReport) fail(hint, format string, a ...interface{}) {
+	r.failures++
+	fmt.Fprintf(r.out, "[FAIL] %s\n", fmt.Sprintf(format, a...))
+	r.hint(hint)
+}
+
+func (r *doctorReport) skip(format string, a ...interface{}) {
+	fmt.Fprintf(r.out, "[SKIP] %s\n", fmt.Sprintf(format, a...))
+}
+
+func (r *doctorReport) hint(hint string) {
+	if len(hint) > 0 {
+		r.details("Hint: " + hint)
+	}
+}
+
+// details prints indented text below the last result.
+func (r *doctorReport) details(text string) {
+	for _, line := range strings.Split(strings.TrimRight(text, "\n"), "\n") {
+		fmt.Fprintf(r.out, "       %s\n", line)
+	}
+}
+
+type appDoctorOptions struct {
+	*opts.GlobalOptions
+	genericclioptions.IOStreams
+	shortcutInstallOptions
+
+	name      string
+	namespace string
+}
+
+func (o *appDoctorOptions) Complete(cmd *cobra.Command, args []string) error {
+	if len(args) != 1 {
+		cmd.SilenceUsage = false
+		return fmt.Errorf("an app name is required")
+	}
+
+	o.name = args[0]
+	if o.Raw().Namespace != nil && len(*o.Raw().Namespace) > 0 {
+		o.namespace = *o.Raw().Namespace
+	}
+
+	return o.shortcutInstallOptions.expand()
+}
+
+func (o *appDoctorOptions) Validate() error {
+	return nil
+}
+
+// Run checks every hop from the local shortcut to the app Pod in order. Cluster checks stop at the first hop
+// the following ones depend on.
+func (o *appDoctorOptions) Run(ctx context.Context) error {
+	r := &doctorReport{out: o.Out}
+	o.checkShortcut(r)
+	o.checkPath(r)
+
+	if len(o.namespace) == 0 {
+		o.namespace = metav1.NamespaceDefault
+	}
+
+	if err := o.checkCluster(ctx, r); err != nil {
+		r.fail("Check the kubeconfig and whether the cluster is up.", "Can't connect to the cluster: %s", err)
+	}
+
+	if r.failures > 0 {
+		return fmt.Errorf("%d checks failed", r.failures)
+	}
+
+	fmt.Fprintln(o.Out, "All checks passed")
+	return nil
+}
+
+// checkCluster runs checks in the cluster. It returns an error if the cluster is unreachable.
+func (o *appDoctorOptions) checkCluster(ctx context.Context, r *doctorReport) error {
+	clientset, err := o.ClientSet()
+	if err != nil {
+		return err
+	}
+
+	conf, err := o.Raw().ToRESTConfig()
+	if err != nil {
+		return err
+	}
+
+	appClient, err := appv1.NewForConfig(conf)
+	if err != nil {
+		return err
+	}
+
+	resources, err := clientset.Discovery().ServerResourcesForGroupVersion(appcorev1.GroupVersion.String())
+	if err != nil && !errors.IsNotFound(err) {
+		return err
+	}
+
+	if !hasKind(resources, "CliApp") {
+		r.fail(`Run "kubectl dev prepare" to install CliApp.`, "CRD CliApp is not installed")
+		return nil
+	}
+
+	r.pass("CRD CliApp is installed")
+	o.checkDeployment(ctx, r, clientset, "cliapp-controller-manager")
+	o.checkDeployment(ctx, r, clientset, "cliapp-session-gate")
+	o.checkGateEndpoints(ctx, r, clientset)
+	app := o.checkApp(ctx, r, appClient)
+	if app == nil {
+		return nil
+	}
+
+	if len(app.Spec.Dockerfile) > 0 {
+		o.checkDeployment(ctx, r, clientset, "buildkitd")
+	}
+
+	o.checkDaemonSet(ctx, r, clientset, "csi-image-warm-metal")
+	o.checkPods(ctx, r, clientset, app)
+	return nil
+}
+
+func hasKind(resources *metav1.APIResourceList, kind string) bool {
+	if resources == nil {
+		return false
+	}
+
+	for _, resource := range resources.APIResources {
+		if resource.Kind == kind {
+			return true
+		}
+	}
+
+	return false
+}
+
+// checkShortcut checks the shortcut of the app and its link in the install base.
+// If no namespace is specified, the one in the shortcut is used in later checks.
+func (o *appDoctorOptions) checkShortcut(r *doctorReport) {
+	appPath := filepath.Join(o.appRoot, o.name)
+	reinstall := fmt.Sprintf(`Run "kubectl dev app install -n <namespace> --name %s ..." to reinstall the app.`, o.name)
+	bytes, err := ioutil.ReadFile(appPath)
+	if err != nil {
+		r.fail(reinstall, `Shortcut "%s" can't be read: %s`, appPath, err)
+		return
+	}
+
+	matches := shortcutApp.FindStringSubmatch(string(bytes))
+	if matches == nil {
+		r.fail(reinstall, `Shortcut "%s" isn't generated by kubectl-dev`, appPath)
+		return
+	}
+
+	namespace, name := strings.Trim(matches[1], "'"), strings.Trim(matches[2], "'")
+	if len(o.namespace) == 0 {
+		o.namespace = namespace
+	}
+
+	if name != o.name || namespace != o.namespace {
+		r.fail(reinstall, `Shortcut "%s" runs app "%s/%s" rather than "%s/%s"`, appPath, namespace, name,
+			o.namespace, o.name)
+		return
+	}
+
+	if info, err := os.Stat(appPath); err == nil && info.Mode().Perm()&0111 == 0 {
+		r.fail(fmt.Sprintf(`Run "chmod +x %s".`, appPath), `Shortcut "%s" isn't executable`, appPath)
+		return
+	}
+
+	if string(bytes) != fmt.Sprintf(appShortcut, utils.ShellQuote(namespace), utils.ShellQuote(name)) {
+		r.warn(`Run "kubectl dev app migrate" to regenerate it.`,
+			`Shortcut "%s" is generated by an earlier version. Arguments and exit codes may not be passed as is`,
+			appPath)
+	} else {
+		r.pass(`Shortcut "%s" runs app "%s/%s"`, appPath, namespace, name)
+	}
+
+	shortcutPath := filepath.Join(o.shortcutRoot, o.name)
+	if target, err := os.Readlink(shortcutPath); err == nil && filepath.Clean(target) == appPath {
+		r.pass(`"%s" links to the shortcut`, shortcutPath)
+		return
+	}
+
+	legacy := filepath.Join(legacyShortcutRoot, o.name)
+	if target, err := os.Readlink(legacy); err == nil && filepath.Clean(target) == appPath {
+		r.warn(`Run "sudo -E kubectl dev app migrate" to move it.`,
+			`Shortcut is linked in the legacy install base "%s"`, legacyShortcutRoot)
+		return
+	}
+
+	r.fail(reinstall, `"%s" doesn't link to the shortcut`, shortcutPath)
+}
+
+// checkPath checks whether the app is run via the shortcut in PATH, and whether the shortcut can find kubectl-dev.
+func (o *appDoctorOptions) checkPath(r *doctorReport) {
+	if _, err := exec.LookPath("kubectl-dev"); err != nil {
+		r.fail("Shortcuts run kubectl-dev. Move it to a directory in PATH.", "kubectl-dev is not in PATH")
+	} else {
+		r.pass("kubectl-dev is in PATH")
+	}
+
+	if !inPath(o.shortcutRoot) {
+		rc, snippet := o.pathSnippet()
+		r.fail(fmt.Sprintf("Add the line below to %s, then restart your shell.\n    %s", rc, snippet),
+			`Install base "%s" is not in PATH`, o.shortcutRoot)
+		return
+	}
+
+	found, err := exec.LookPath(o.name)
+	if err != nil {
+		r.fail("", `"%s" is not found in PATH: %s`, o.name, err)
+		return
+	}
+
+	if filepath.Clean(found) != filepath.Join(o.shortcutRoot, o.name) &&
+		filepath.Clean(found) != filepath.Join(legacyShortcutRoot, o.name) {
+		r.fail(fmt.Sprintf(`Move "%s" before other directories in PATH, or remove "%s".`, o.shortcutRoot, found),
+			`"%s" in PATH is "%s" rather than the shortcut`, o.name, found)
+		return
+	}
+
+	r.pass(`"%s" in PATH is the shortcut`, o.name)
+}
+
+func (o *appDoctorOptions) checkDeployment(ctx context.Context, r *doctorReport, clientset *kubernetes.Clientset, name string) {
+	hint := fmt.Sprintf(`Run "kubectl -n %s describe deploy %s" and "kubectl -n %s logs deploy/%s" for details, `+
+		`or "kubectl dev prepare" to reinstall it.`, cliappNamespace, name, cliappNamespace, name)
+	deploy, err := clientset.AppsV1().Deployments(cliappNamespace).Get(ctx, name, metav1.GetOptions{})
+	if err != nil {
+		r.fail(`Run "kubectl dev prepare" to install CliApp.`, "Can't fetch Deployment %s/%s: %s",
+			cliappNamespace, name, err)
+		return
+	}
+
+	if deploy.Status.ReadyReplicas > 0 {
+		r.pass("Deployment %s/%s is ready (%d/%d)", cliappNamespace, name, deploy.Status.ReadyReplicas,
+			deploy.Status.Replicas)
+		return
+	}
+
+	r.fail(hint, "Deployment %s/%s is not ready (%d/%d)", cliappNamespace, name, deploy.Status.ReadyReplicas,
+		deploy.Status.Replicas)
+	if deploy.Spec.Selector != nil {
+		o.checkWorkloadPods(ctx, r, clientset, labels.SelectorFromSet(deploy.Spec.Selector.MatchLabels))
+	}
+}
+
+func (o *appDoctorOptions) checkDaemonSet(ctx context.Context, r *doctorReport, clientset *kubernetes.Clientset, name string) {
+	ds, err := clientset.AppsV1().DaemonSets(cliappNamespace).Get(ctx, name, metav1.GetOptions{})
+	if err != nil {
+		r.fail(`Run "kubectl dev prepare" to install CliApp.`, "Can't fetch DaemonSet %s/%s: %s",
+			cliappNamespace, name, err)
+		return
+	}
+
+	if ds.Status.DesiredNumberScheduled > 0 && ds.Status.NumberReady == ds.Status.DesiredNumberScheduled {
+		r.pass("DaemonSet %s/%s is ready (%d/%d)", cliappNamespace, name, ds.Status.NumberReady,
+			ds.Status.DesiredNumberScheduled)
+		return
+	}
+
+	r.fail(fmt.Sprintf(`Images of apps are mounted by it. Run "kubectl -n %s describe ds %s" for details.`,
+		cliappNamespace, name),
+		"DaemonSet %s/%s is not ready (%d/%d)", cliappNamespace, name, ds.Status.NumberReady,
+		ds.Status.DesiredNumberScheduled)
+	if ds.Spec.Selector != nil {
+		o.checkWorkloadPods(ctx, r, clientset, labels.SelectorFromSet(ds.Spec.Selector.MatchLabels))
+	}
+}
+
+// checkGateEndpoints dials each session gate endpoint. Sessions try endpoints in order and wait for each one until
+// it is connected, so an unreachable endpoint before the reachable one may hang sessions.
+func (o *appDoctorOptions) checkGateEndpoints(ctx context.Context, r *doctorReport, clientset *kubernetes.Clientset) {
+	endpoints, err := libcli.FetchGateEndpoints(ctx, clientset)
+	if err != nil {
+		r.fail(`Run "kubectl dev prepare" to install CliApp.`, "Can't fetch session gate endpoints: %s", err)
+		return
+	}
+
+	reachable := false
+	for _, ep := range endpoints {
+		endpoint, err := url.Parse(ep)
+		if err != nil {
+			r.fail("", `Invalid session gate endpoint "%s": %s`, ep, err)
+			continue
+		}
+
+		conn, err := net.DialTimeout("tcp", endpoint.Host, gateDialTimeout)
+		if err == nil {
+			conn.Close()
+			r.pass("Session gate endpoint %s is reachable", endpoint.Host)
+			reachable = true
+			continue
+		}
+
+		if reachable {
+			r.warn("", "Session gate endpoint %s is unreachable: %s", endpoint.Host, err)
+			continue
+		}
+
+		r.fail("Sessions keep waiting for it. Check the firewall, or whether the Service "+
+			cliappNamespace+"/cliapp-session-gate is exposed via a LoadBalancer or a NodePort reachable locally.",
+			"Session gate endpoint %s is unreachable: %s", endpoint.Host, err)
+	}
+}
+
+// checkApp checks the status of the CliApp and returns it if found.
+func (o *appDoctorOptions) checkApp(ctx context.Context, r *doctorReport, appClient appv1.Interface) *appcorev1.CliApp {
+	app, err := appClient.CliappV1().CliApps(o.namespace).Get(ctx, o.name, metav1.GetOptions{})
+	if errors.IsNotFound(err) {
+		r.fail(fmt.Sprintf(`Run "kubectl dev app install -n %s --name %s ..." to reinstall it, `+
+			`or "kubectl dev app uninstall %s" to remove the shortcut.`, o.namespace, o.name, o.name),
+			"CliApp %s/%s doesn't exist", o.namespace, o.name)
+		return nil
+	}
+
+	if err != nil {
+		r.fail("", "Can't fetch CliApp %s/%s: %s", o.namespace, o.name, err)
+		return nil
+	}
+
+	controllerLogs := fmt.Sprintf(`Run "kubectl -n %s logs deploy/cliapp-controller-manager" for details.`,
+		cliappNamespace)
+	if len(app.Status.Error) > 0 {
+		hint := controllerLogs
+		if app.Status.Phase == appcorev1.CliAppPhaseBuilding {
+			hint = fmt.Sprintf(`Check the Dockerfile, or run "kubectl -n %s logs deploy/buildkitd" for details.`,
+				cliappNamespace)
+		}
+
+		r.fail(hint, "CliApp %s/%s is %s with error: %s", o.namespace, o.name, app.Status.Phase, app.Status.Error)
+		return app
+	}
+
+	since := time.Since(app.Status.LastPhaseTransition.Time)
+	if app.Status.Phase == appcorev1.CliAppPhaseBuilding && since > longBuildDuration {
+		r.warn(fmt.Sprintf(`Run "kubectl -n %s logs deploy/buildkitd" for details.`, cliappNamespace),
+			"CliApp %s/%s has been building for %s", o.namespace, o.name, since.Round(time.Second))
+		return app
+	}
+
+	r.pass("CliApp %s/%s is %s, target %s", o.namespace, o.name, valueOrNone(string(app.Status.Phase)),
+		valueOrNone(string(app.Spec.TargetPhase)))
+	return app
+}
+
+// checkPods checks Pods of the app. Apps at rest have no Pod.
+func (o *appDoctorOptions) checkPods(
+	ctx context.Context, r *doctorReport, clientset *kubernetes.Clientset, app *appcorev1.CliApp,
+) {
+	pods, err := clientset.CoreV1().Pods(app.Namespace).List(ctx, metav1.ListOptions{
+		LabelSelector: labels.Set{appPodLabel: app.Name}.AsSelector().String(),
+	})
+	if err != nil {
+		r.fail("", "Can't list Pods of CliApp %s/%s: %s", app.Namespace, app.Name, err)
+		return
+	}
+
+	if len(pods.Items) == 0 {
+		if app.Spec.TargetPhase == appcorev1.CliAppPhaseLive {
+			r.fail(fmt.Sprintf(`Run "kubectl -n %s logs deploy/cliapp-controller-manager" for details.`,
+				cliappNamespace), "No Pod of CliApp %s/%s found while it is going live", app.Namespace, app.Name)
+			return
+		}
+
+		r.skip("No Pod of CliApp %s/%s since it is at rest. A Pod is created in the next session",
+			app.Namespace, app.Name)
+		return
+	}
+
+	o.diagnosePods(ctx, r, clientset, pods.Items)
+}
+
+// checkWorkloadPods checks Pods of a workload in the CliApp namespace.
+func (o *appDoctorOptions) checkWorkloadPods(
+	ctx context.Context, r *doctorReport, clientset *kubernetes.Clientset, selector labels.Selector,
+) {
+	pods, err := clientset.CoreV1().Pods(cliappNamespace).List(ctx, metav1.ListOptions{LabelSelector: selector.String()})
+	if err != nil {
+		r.details(fmt.Sprintf("Can't list Pods: %s", err))
+		return
+	}
+
+	o.diagnosePods(ctx, r, clientset, pods.Items)
+}
+
+// diagnosePods reports whether each Pod is ready, along with events and logs of those not.
+func (o *appDoctorOptions) diagnosePods(
+	ctx context.Context, r *doctorReport, clientset *kubernetes.Clientset, pods []corev1.Pod,
+) {
+	for i := range pods {
+		pod := &pods[i]
+		if utils.IsPodReady(pod) {
+			r.pass("Pod %s/%s is ready", pod.Namespace, pod.Name)
+			continue
+		}
+
+		r.fail(fmt.Sprintf(`Run "kubectl -n %s describe pod %s" for details.`, pod.Namespace, pod.Name),
+			"Pod %s/%s is not ready, %s", pod.Namespace, pod.Name, pod.Status.Phase)
+		var out bytes.Buffer
+		diagnose.Pod(ctx, clientset, pod, &out)
+
+		if out.Len() == 0 {
+			o.printPodWarnings(ctx, clientset, pod, &out)
+		}
+
+		if out.Len() > 0 {
+			r.details(out.String())
+		}
+	}
+}
+
+// printPodWarnings prints warning events of the Pod, as well as logs of containers not ready.
+func (o *appDoctorOptions) printPodWarnings(
+	ctx context.Context, clientset *kubernetes.Clientset, pod *corev1.Pod, out io.Writer,
+) {
+	events, err := clientset.CoreV1().Events(pod.Namespace).List(ctx, metav1.ListOptions{
+		FieldSelector: fields.Set{
+			"involvedObject.name": pod.Name,
+			"involvedObject.uid":  string(pod.UID),
+			"type":                corev1.EventTypeWarning,
+		}.AsSelector().String(),
+	})
+	if err == nil {
+		for _, event := range events.Items {
+			fmt.Fprintf(out, "%s: %s (x%d)\n", event.Reason, strings.TrimSpace(event.Message), event.Count)
+		}
+	}
+
+	for _, status := range pod.Status.ContainerStatuses {
+		if status.Ready || status.State.Running == nil {
+			continue
+		}
+
+		tail := int64(20)
+		logs, err := clientset.CoreV1().Pods(pod.Namespace).GetLogs(pod.Name, &corev1.PodLogOptions{
+			Container: status.Name,
+			TailLines: &tail,
+		}).DoRaw(ctx)
+		if err != nil || len(logs) == 0 {
+			continue
+		}
+
+		fmt.Fprintf(out, "Logs of container %s:\n%s\n", status.Name, logs)
+	}
+}
+
+func newAppDoctorCmd(opts *opts.GlobalOptions, streams genericclioptions.IOStreams) *cobra.Command {
+	o := &appDoctorOptions{
+		GlobalOptions:          opts,
+		IOStreams:              streams,
+		shortcutInstallOptions: initShortcutInstallOptions(),
+	}
+
+	var cmd = &cobra.Command{
+		Use:   "doctor [OPTIONS] name",
+		Short: "Diagnose a CliApp end to end.",
+		Long: `Check every hop from the local shortcut of a CliApp to its Pod in order, then print a report.
+Hops are the shortcut and its link, PATH, the CliApp CRD, the controller and the session gate,
+endpoints of the session gate, the CliApp status, the image builder and the image driver, and the app Pod.
+Each failure comes with a hint to fix it. The command fails if any check fails.
+The namespace in the shortcut is used if not specified via "-n".`,
+		Example: `# Diagnose app ctr
+kubectl dev app doctor ctr
+`,
+		SilenceUsage: true,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			if err := o.Complete(cmd, args); err != nil {
+				return err
+			}
+			if err := o.Validate(); err != nil {
+				return err
+			}
+			if err := o.Run(cmd.Context()); err != nil {
+				return err
+			}
+
+			return nil
+		},
+	}
+
+	cmd.Flags().StringVar(&o.shortcutRoot, "install-base", o.shortcutRoot,
+		"Directory where app shortcuts are installed. "+
+			"The default value is $XDG_BIN_HOME, or ~/.local/bin if not set.")
+	o.AddPersistentFlags(cmd.Flags())
+	return cmd
+}
@@ -0,0 +1,100 @@
+package app
+
+import (
+	"context"
+	"fmt"
+	appcorev1 "github.com/warm-metal/cliapp/pkg/apis/cliapp/v1"
+	appv1 "github.com/warm-metal/cliapp/pkg/clientset/versioned"
+	"github.com/warm-metal/kubectl-dev/pkg/kubectl"
+	"github.com/warm-metal/kubectl-dev/pkg/utils"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/util/retry"
+	"time"
+)
+
+// startApp brings the app up if it is at rest. It returns true if the app is started by this call.
+func startApp(ctx context.Context, appClient appv1.Interface, app *appcorev1.CliApp) (started bool, err error) {
+	err = retry.RetryOnConflict(retry.DefaultRetry, func() error {
+		current, err := appClient.CliappV1().CliApps(app.Namespace).Get(ctx, app.Name, metav1.GetOptions{})
+		if err != nil {
+			return err
+		}
+
+		if current.Status.Phase == appcorev1.CliAppPhaseLive || current.Spec.TargetPhase == appcorev1.CliAppPhaseLive {
+			return nil
+		}
+
+		current.Spec.TargetPhase = appcorev1.CliAppPhaseLive
+		_, err = appClient.CliappV1().CliApps(app.Namespace).Update(ctx, current, metav1.UpdateOptions{})
+		started = err == nil
+		return err
+	})
+
+	return
+}
+
+// stopApp puts the app to rest.
+func stopApp(ctx context.Context, appClient appv1.Interface, app *appcorev1.CliApp) error {
+	return retry.RetryOnConflict(retry.DefaultRetry, func() error {
+		current, err := appClient.CliappV1().CliApps(app.Namespace).Get(ctx, app.Name, metav1.GetOptions{})
+		if err != nil {
+			return err
+		}
+
+		if current.Spec.TargetPhase == appcorev1.CliAppPhaseRest {
+			return nil
+		}
+
+		current.Spec.TargetPhase = appcorev1.CliAppPhaseRest
+		_, err = appClient.CliappV1().CliApps(app.Namespace).Update(ctx, current, metav1.UpdateOptions{})
+		return err
+	})
+}
+
+// runLive brings the app up if necessary, then calls fn with the live app.
+// The gate puts apps to rest once sessions are closed. The same thing is done if the app is brought up here.
+func (o *AppOptions) runLive(
+	ctx context.Context, appClient appv1.Interface, app *appcorev1.CliApp, fn func(*appcorev1.CliApp) error,
+) error {
+	started, err := startApp(ctx, appClient, app)
+	if err != nil {
+		return err
+	}
+
+	if started {
+		defer func() {
+			stopCtx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+			defer cancel()
+			if err := stopApp(stopCtx, appClient, app); err != nil {
+				fmt.Fprintf(o.ErrOut, "unable to put app %s to rest: %s\n", app.Name, err)
+			}
+		}()
+	}
+
+	if app, err = utils.WaitForAppPod(ctx, appClient, app, o.ErrOut); err != nil {
+		return err
+	}
+
+	return fn(app)
+}
+
+// execApp runs the command via kubectl exec in the app image, in the directory if not empty.
+// Unlike sessions opened through the gate, stdin and stdout are passed as is and stderr is kept apart.
+// A TTY is allocated only if both stdin and stdout are terminals.
+// If the command fails, an exec.CodeExitError is returned with its exit code.
+func (o *AppOptions) execApp(app *appcorev1.CliApp, dir string, command []string) error {
+	args := []string{"chroot", appRoot}
+	if len(dir) > 0 {
+		args = append(args, "sh", "-c", `cd "$0" && exec "$@"`, dir)
+	}
+
+	args = append(args, command...)
+	tty := utils.IsTerminal(o.In) && utils.IsTerminal(o.Out)
+	return o.RunExec(app.Status.PodName, app.Namespace, utils.AppContainer, tty, args,
+		kubectl.WithStdin(o.In), kubectl.WithStdout(o.Out), kubectl.WithStderr(o.ErrOut))
+}
+
+// appCommand returns the app command followed by arguments.
+func (o *AppOptions) appCommand(app *appcorev1.CliApp) []string {
+	return append(append([]string(nil), app.Spec.Command...), o.args...)
+}
@@ -0,0 +1,149 @@
+package app
+
+import (
+	"context"
+	"fmt"
+	"github.com/spf13/cobra"
+	appcorev1 "github.com/warm-metal/cliapp/pkg/apis/cliapp/v1"
+	appv1 "github.com/warm-metal/cliapp/pkg/clientset/versioned"
+	"github.com/warm-metal/kubectl-dev/pkg/cmd/opts"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/cli-runtime/pkg/genericclioptions"
+	"sigs.k8s.io/yaml"
+	"sort"
+)
+
+type appExportOptions struct {
+	*opts.GlobalOptions
+	genericclioptions.IOStreams
+
+	names     []string
+	namespace string
+}
+
+func (o *appExportOptions) Complete(cmd *cobra.Command, args []string) error {
+	o.names = args
+	if o.Raw().Namespace != nil && len(*o.Raw().Namespace) > 0 {
+		o.namespace = *o.Raw().Namespace
+	}
+
+	return nil
+}
+
+func (o *appExportOptions) Validate() error {
+	return nil
+}
+
+func (o *appExportOptions) Run(ctx context.Context) error {
+	conf, err := o.Raw().ToRESTConfig()
+	if err != nil {
+		return err
+	}
+
+	appClient, err := appv1.NewForConfig(conf)
+	if err != nil {
+		return err
+	}
+
+	apps, err := appClient.CliappV1().CliApps(o.namespace).List(ctx, metav1.ListOptions{})
+	if err != nil {
+		return err
+	}
+
+	manifest, err := o.export(apps.Items)
+	if err != nil {
+		return err
+	}
+
+	bytes, err := yaml.Marshal(manifest)
+	if err != nil {
+		return err
+	}
+
+	_, err = o.Out.Write(bytes)
+	return err
+}
+
+// export returns the manifest of apps to be exported, sorted by namespaces and names.
+// Forked apps are skipped since they are created by sessions.
+func (o *appExportOptions) export(apps []appcorev1.CliApp) (*appManifest, error) {
+	wanted := make(map[string]bool, len(o.names))
+	for _, name := range o.names {
+		wanted[name] = false
+	}
+
+	manifest := &appManifest{Apps: []appDefinition{}}
+	for i := range apps {
+		app := &apps[i]
+		if found, ok := wanted[app.Name]; len(o.names) > 0 && !ok {
+			continue
+		} else if found {
+			return nil, fmt.Errorf(`app "%s" is found in more than one namespace. Specify the namespace via "-n"`,
+				app.Name)
+		}
+
+		wanted[app.Name] = true
+		if app.Spec.Fork != nil {
+			fmt.Fprintf(o.ErrOut, "Warning: skip forked app \"%s/%s\".\n", app.Namespace, app.Name)
+			continue
+		}
+
+		manifest.Apps = append(manifest.Apps, fromCliApp(app))
+	}
+
+	for _, name := range o.names {
+		if !wanted[name] {
+			return nil, fmt.Errorf(`app "%s" not found`, name)
+		}
+	}
+
+	sort.Slice(manifest.Apps, func(i, j int) bool {
+		if manifest.Apps[i].Namespace != manifest.Apps[j].Namespace {
+			return manifest.Apps[i].Namespace < manifest.Apps[j].Namespace
+		}
+
+		return manifest.Apps[i].Name < manifest.Apps[j].Name
+	})
+
+	return manifest, nil
+}
+
+func newAppExportCmd(opts *opts.GlobalOptions, streams genericclioptions.IOStreams) *cobra.Command {
+	o := &appExportOptions{
+		GlobalOptions: opts,
+		IOStreams:     streams,
+		namespace:     metav1.NamespaceAll,
+	}
+
+	var cmd = &cobra.Command{
+		Use:   "export [name...]",
+		Short: "Print CliApps as a manifest.",
+		Long: `Print CliApps as a manifest, which can be imported to other clusters via "app import" or "app apply".
+All apps are exported if no name is given, in the namespace specified via "-n", or in all namespaces if not set.
+Apps pinned to image digests by "app upgrade" are exported with the images they are defined with.
+Proxies are exported as environment variables.`,
+		Example: `# Export all CliApps to apps.yaml
+kubectl dev app export > apps.yaml
+
+# Copy CliApps in namespace app to the cluster of context prod
+kubectl dev app export -n app | kubectl dev --context prod app import -
+`,
+		SilenceUsage: true,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			if err := o.Complete(cmd, args); err != nil {
+				return err
+			}
+			if err := o.Validate(); err != nil {
+				return err
+			}
+			if err := o.Run(cmd.Context()); err != nil {
+				return err
+			}
+
+			return nil
+		},
+	}
+
+	o.AddPersistentFlags(cmd.Flags())
+	return cmd
+}
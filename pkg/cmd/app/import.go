@@ -0,0 +1,282 @@
+package app
+
+import (
+	"context"
+	"fmt"
+	"github.com/spf13/cobra"
+	appcorev1 "github.com/warm-metal/cliapp/pkg/apis/cliapp/v1"
+	appv1 "github.com/warm-metal/cliapp/pkg/clientset/versioned"
+	"github.com/warm-metal/kubectl-dev/pkg/cmd/opts"
+	"k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/cli-runtime/pkg/genericclioptions"
+	"sort"
+)
+
+type appImportOptions struct {
+	*opts.GlobalOptions
+	genericclioptions.IOStreams
+	shortcutInstallOptions
+
+	file      string
+	namespace string
+	reconcile bool
+	catalogs  []string
+
+	// scope is the namespace where shortcuts are reconciled. Empty means all namespaces.
+	scope string
+
+	apps []*appcorev1.CliApp
+
+	// loadedCatalogs caches catalogs loaded while reconciling.
+	loadedCatalogs []*catalog
+}
+
+func (o *appImportOptions) Complete(cmd *cobra.Command, args []string) error {
+	if len(args) > 1 || (len(args) == 0 && !o.reconcile) {
+		cmd.SilenceUsage = false
+		return fmt.Errorf("a manifest is required unless --reconcile is set")
+	}
+
+	if o.Raw().Namespace != nil && len(*o.Raw().Namespace) > 0 {
+		o.namespace = *o.Raw().Namespace
+		o.scope = o.namespace
+	}
+
+	if err := o.shortcutInstallOptions.expand(); err != nil {
+		return err
+	}
+
+	if len(args) == 0 {
+		return nil
+	}
+
+	o.file = args[0]
+	manifest, err := loadManifest(o.file, o.In)
+	if err != nil {
+		return err
+	}
+
+	for i := range manifest.Apps {
+		app, err := manifest.Apps[i].toCliApp(o.namespace)
+		if err != nil {
+			return err
+		}
+
+		o.apps = append(o.apps, app)
+	}
+
+	return nil
+}
+
+func (o *appImportOptions) Validate() error {
+	return validateUniqueNames(o.apps)
+}
+
+func (o *appImportOptions) Run(ctx context.Context) error {
+	conf, err := o.Raw().ToRESTConfig()
+	if err != nil {
+		return err
+	}
+
+	appClient, err := appv1.NewForConfig(conf)
+	if err != nil {
+		return err
+	}
+
+	if o.reconcile {
+		err = o.reconcileShortcuts(ctx, appClient)
+	} else {
+		err = o.importApps(ctx, appClient)
+	}
+
+	if prepareErr := o.shortcutInstallOptions.prepare(); prepareErr != nil {
+		return prepareErr
+	}
+
+	o.printPathHint(o.ErrOut)
+	return err
+}
+
+// importApps creates or updates all apps in the manifest, and installs their shortcuts.
+func (o *appImportOptions) importApps(ctx context.Context, appClient appv1.Interface) error {
+	for _, app := range o.apps {
+		result, err := o.applyApp(ctx, appClient, app, o.ErrOut)
+		if err != nil {
+			return err
+		}
+
+		fmt.Fprintf(o.Out, "cliapp %s/%s %s\n", app.Namespace, app.Name, result)
+	}
+
+	return nil
+}
+
+// reconcileShortcuts re-creates apps which local shortcuts point to but don't exist in the cluster.
+// Apps are defined by the manifest if given, then by definitions saved along with shortcuts, then by catalogs.
+func (o *appImportOptions) reconcileShortcuts(ctx context.Context, appClient appv1.Interface) error {
+	shortcuts, err := o.listShortcuts()
+	if err != nil {
+		return err
+	}
+
+	var names []string
+	for name, shortcut := range shortcuts {
+		if len(o.scope) == 0 || shortcut.namespace == o.scope {
+			names = append(names, name)
+		}
+	}
+
+	sort.Strings(names)
+	missing, failed := 0, 0
+	for _, name := range names {
+		shortcut := shortcuts[name]
+		_, err := appClient.CliappV1().CliApps(shortcut.namespace).Get(ctx, shortcut.name, metav1.GetOptions{})
+		if err == nil {
+			continue
+		}
+
+		if !errors.IsNotFound(err) {
+			return err
+		}
+
+		missing++
+		def, source, err := o.lookupDefinition(ctx, shortcut.name)
+		if err == nil && def == nil {
+			err = fmt.Errorf("no definition found in the manifest, local definitions, or catalogs")
+		}
+
+		var app *appcorev1.CliApp
+		if err == nil {
+			// Shortcuts are kept as is, so apps are re-created in the namespaces they point to.
+			def.Name = shortcut.name
+			def.Namespace = shortcut.namespace
+			app, err = def.toCliApp(shortcut.namespace)
+		}
+
+		if err == nil {
+			_, err = o.applyApp(ctx, appClient, app, o.ErrOut)
+		}
+
+		if err != nil {
+			// Failures of an app don't stop reconciling others.
+			fmt.Fprintf(o.ErrOut, "can't re-create app \"%s/%s\": %s\n", shortcut.namespace, shortcut.name, err)
+			failed++
+			continue
+		}
+
+		fmt.Fprintf(o.Out, "cliapp %s/%s re-created from %s\n", app.Namespace, app.Name, source)
+	}
+
+	if failed > 0 {
+		return fmt.Errorf("%d of %d missing apps failed to be re-created", failed, missing)
+	}
+
+	if missing == 0 {
+		fmt.Fprintln(o.ErrOut, "No missing CliApps found.")
+	}
+
+	return nil
+}
+
+// lookupDefinition returns the definition of the app and where it is found, or nil if not found.
+func (o *appImportOptions) lookupDefinition(ctx context.Context, name string) (*appDefinition, string, error) {
+	for _, app := range o.apps {
+		if app.Name == name {
+			def := fromCliApp(app)
+			return &def, o.file, nil
+		}
+	}
+
+	def, err := o.loadDefinition(name)
+	if err != nil || def != nil {
+		return def, o.definitionPath(name), err
+	}
+
+	if o.loadedCatalogs == nil {
+		// Catalogs are optional while reconciling.
+		sources, err := loadCatalogSources(o.catalogs)
+		if err != nil {
+			return nil, "", nil
+		}
+
+		var catalogs []*catalog
+		for _, source := range sources {
+			c, err := loadCatalog(ctx, source)
+			if err != nil {
+				return nil, "", err
+			}
+
+			catalogs = append(catalogs, c)
+		}
+
+		o.loadedCatalogs = catalogs
+	}
+
+	for _, c := range o.loadedCatalogs {
+		def, err := c.lookup(name)
+		if err != nil || def != nil {
+			return def, "catalog " + c.source, err
+		}
+	}
+
+	return nil, "", nil
+}
+
+func newAppImportCmd(opts *opts.GlobalOptions, streams genericclioptions.IOStreams) *cobra.Command {
+	o := &appImportOptions{
+		GlobalOptions:          opts,
+		IOStreams:              streams,
+		namespace:              metav1.NamespaceDefault,
+		shortcutInstallOptions: initShortcutInstallOptions(),
+	}
+
+	var cmd = &cobra.Command{
+		Use:   "import [OPTIONS] manifest|--reconcile [manifest]",
+		Short: "Install CliApps exported from other clusters, or re-create CliApps of local shortcuts.",
+		Long: `Install or update all CliApps in a manifest exported via "app export", as well as their shortcuts.
+The manifest is in the same format as the one of "app apply", but apps imported are never pruned.
+Apps without a namespace are imported to the namespace specified via "-n", or "default" if not set.
+
+With "--reconcile", apps which local shortcuts in ~/.cliapps point to but don't exist in the cluster, e.g.,
+after switching to a new cluster, are re-created. Only shortcuts in the namespace specified via "-n" are
+reconciled if set. Each app is defined by the first one found in
+  1. the manifest if given;
+  2. the definition saved along with the shortcut when the app was installed;
+  3. catalogs, specified via "--catalog" or in "~/.kubectl-dev/catalog".`,
+		Example: `# Copy all CliApps from the current cluster to the cluster of context prod
+kubectl dev app export > apps.yaml
+kubectl dev app import --context prod apps.yaml
+
+# Read the manifest from stdin
+kubectl dev app export -n app | kubectl dev app import --context prod -
+
+# Re-create CliApps of all local shortcuts in the current cluster
+kubectl dev app import --reconcile
+`,
+		SilenceUsage: true,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			if err := o.Complete(cmd, args); err != nil {
+				return err
+			}
+			if err := o.Validate(); err != nil {
+				return err
+			}
+			if err := o.Run(cmd.Context()); err != nil {
+				return err
+			}
+
+			return nil
+		},
+	}
+
+	cmd.Flags().BoolVar(&o.reconcile, "reconcile", false,
+		"Re-create apps which local shortcuts point to but don't exist, rather than importing the manifest.")
+	cmd.Flags().StringSliceVar(&o.catalogs, "catalog", nil,
+		"Catalogs where apps are looked up while reconciling. The default catalogs are used if not set.")
+	cmd.Flags().StringVar(&o.shortcutRoot, "install-base", o.shortcutRoot,
+		"Directory where app shortcuts to be installed. It should be one of the PATH. "+
+			"The default value is $XDG_BIN_HOME, or ~/.local/bin if not set.")
+	o.AddPersistentFlags(cmd.Flags())
+	return cmd
+}
@@ -7,8 +7,6 @@ import (
 	appcorev1 "github.com/warm-metal/cliapp/pkg/apis/cliapp/v1"
 	appv1 "github.com/warm-metal/cliapp/pkg/clientset/versioned"
 	"github.com/warm-metal/kubectl-dev/pkg/cmd/opts"
-	"github.com/warm-metal/kubectl-dev/pkg/utils"
-	"k8s.io/apimachinery/pkg/api/errors"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 	"k8s.io/cli-runtime/pkg/genericclioptions"
 )
@@ -17,78 +15,73 @@ type appInstallOptions struct {
 	*opts.GlobalOptions
 	genericclioptions.IOStreams
 	shortcutInstallOptions
+	appDefinition
 
-	name      string
 	namespace string
-
-	image      string
-	dockerfile string
-
-	hostPaths []string
-	envs      []string
-
-	distro string
-	shell  string
-
-	useHttpProxy bool
+	catalogs  []string
 
 	app *appcorev1.CliApp
 }
 
-func (o *appInstallOptions) Complete(_ *cobra.Command, args []string) error {
+func (o *appInstallOptions) Complete(cmd *cobra.Command, args []string) error {
 	if o.Raw().Namespace != nil && len(*o.Raw().Namespace) > 0 {
 		o.namespace = *o.Raw().Namespace
 	}
 
-	if err := o.shortcutInstallOptions.init(o.name); err != nil {
+	o.Command = args
+	if len(o.Image) == 0 && len(o.Dockerfile) == 0 && len(args) > 0 {
+		if err := o.mergeCatalogApp(cmd.Context(), args[0], args[1:]); err != nil {
+			return err
+		}
+	}
+
+	if err := o.shortcutInstallOptions.init(o.Name); err != nil {
 		return err
 	}
 
-	o.app = &appcorev1.CliApp{
-		ObjectMeta: metav1.ObjectMeta{
-			Name:      o.name,
-			Namespace: o.namespace,
-		},
-		Spec: appcorev1.CliAppSpec{
-			Image:       o.image,
-			Dockerfile:  o.dockerfile,
-			Command:     args,
-			HostPath:    o.hostPaths,
-			Env:         o.envs,
-			TargetPhase: appcorev1.CliAppPhaseRest,
-		},
+	app, err := o.appDefinition.toCliApp(o.namespace)
+	if err != nil {
+		return err
 	}
 
-	if len(args) == 0 {
-		o.app.Spec.Command = []string{o.name}
+	o.app = app
+	return nil
+}
+
+// mergeCatalogApp uses the app in catalogs as the base of the app to be installed.
+// Flags override the name, distro, shell and workdir of the recipe, while envs and host paths are appended.
+// Arguments following the catalog name override the command.
+func (o *appInstallOptions) mergeCatalogApp(ctx context.Context, name string, args []string) error {
+	def, err := lookupCatalogApp(ctx, o.catalogs, name)
+	if err != nil {
+		return err
 	}
 
-	if len(o.distro) > 0 {
-		distro, err := utils.ValidateDistro(o.distro)
-		if err != nil {
-			return err
-		}
+	if len(o.Name) > 0 {
+		def.Name = o.Name
+	}
 
-		o.app.Spec.Distro = distro
+	if len(args) > 0 {
+		def.Command = args
 	}
 
-	if len(o.shell) > 0 {
-		shell, err := utils.ValidateShell(o.shell)
-		if err != nil {
-			return err
-		}
+	if len(o.Distro) > 0 {
+		def.Distro = o.Distro
+	}
 
-		o.app.Spec.Shell = shell
+	if len(o.Shell) > 0 {
+		def.Shell = o.Shell
 	}
 
-	if o.useHttpProxy {
-		proxies, err := utils.GetSysProxyEnvs()
-		if err != nil {
-			return err
-		}
-		o.app.Spec.Env = append(o.app.Spec.Env, proxies...)
+	if len(o.Workdir) > 0 {
+		def.Workdir = o.Workdir
 	}
 
+	def.Namespace = ""
+	def.Env = append(def.Env, o.Env...)
+	def.HostPaths = append(def.HostPaths, o.HostPaths...)
+	def.UseProxy = def.UseProxy || o.UseProxy
+	o.appDefinition = *def
 	return nil
 }
 
@@ -107,28 +100,12 @@ func (o *appInstallOptions) Run(ctx context.Context) error {
 		return err
 	}
 
-	app, err := appClient.CliappV1().CliApps(o.app.Namespace).Get(ctx, o.app.Name, metav1.GetOptions{})
-	if err == nil {
-		app.Spec = o.app.Spec
-		_, err = appClient.CliappV1().CliApps(o.app.Namespace).Update(ctx, app, metav1.UpdateOptions{})
-		if err != nil {
-			return err
-		}
-	} else {
-		_, err = appClient.CliappV1().CliApps(o.app.Namespace).Create(ctx, o.app, metav1.CreateOptions{})
-		if err != nil {
-			if !errors.IsAlreadyExists(err) {
-				return err
-			}
-
-		}
-	}
-
-	if err := o.installShortcut(o.app.Name, o.app.Namespace); err != nil {
+	if _, err = o.applyApp(ctx, appClient, o.app, o.ErrOut); err != nil {
 		return err
 	}
 
 	fmt.Println("Installed")
+	o.printPathHint(o.ErrOut)
 	return nil
 }
 
@@ -141,23 +118,31 @@ func newAppInstallCmd(opts *opts.GlobalOptions, streams genericclioptions.IOStre
 	}
 
 	var cmd = &cobra.Command{
-		Use:   "install [OPTIONS] [command]",
+		Use:   "install [OPTIONS] [command | catalog-app [command]]",
 		Short: "Install an CliApp.",
-		Long:  `A CliApp is executed in any local terminal then runs in a K8s cluster.`,
+		Long: `A CliApp is executed in any local terminal then runs in a K8s cluster.
+If neither an image nor a Dockerfile is specified, the first argument is the name of an app in catalogs.
+See "kubectl dev app search -h" for details about catalogs.`,
 		Example: `# Install ctr via an image to work with node containerd, then, you can run "ctr i ls" to show all images.
 # The last argument "crictl" shows that command crictl will be executed in the Pod once the app is executed.
 # If omitted, the command same with the app name is started instead.
-sudo -E kubectl dev app install --name ctr -n default --env CONTAINERD_NAMESPACE=k8s.io \
+kubectl dev app install --name ctr -n default --env CONTAINERD_NAMESPACE=k8s.io \
 	--hostpath /var/run/containerd/containerd.sock \
 	--image docker.io/warmmetal/ctr:v1 \
 	--use-proxy \
 	ctr
 
 # Install ctr via a Dockerfile.
-sudo -E kubectl dev app install --name ctr -n default --env CONTAINERD_NAMESPACE=k8s.io \
+kubectl dev app install --name ctr -n default --env CONTAINERD_NAMESPACE=k8s.io \
 	--hostpath /var/run/containerd/containerd.sock \
 	--dockerfile https://raw.githubusercontent.com/warm-metal/cliapps/master/ctr/Dockerfile \
 	--use-proxy
+
+# Install ctr in catalogs. Flags are merged with the recipe in the catalog.
+kubectl dev app install ctr --use-proxy
+
+# Install ctr in a specific catalog as a different name.
+kubectl dev app install --name containerd-ctr --catalog ~/cliapps ctr
 `,
 		SilenceUsage: true,
 		RunE: func(cmd *cobra.Command, args []string) error {
@@ -175,18 +160,24 @@ sudo -E kubectl dev app install --name ctr -n default --env CONTAINERD_NAMESPACE
 		},
 	}
 
-	cmd.Flags().StringVar(&o.name, "name", "", "App name")
-	cmd.Flags().StringVar(&o.image, "image", "", "Image the app uses")
-	cmd.Flags().StringVar(&o.dockerfile, "dockerfile", "", "Dockerfile to build image that the app uses")
-	cmd.Flags().StringSliceVar(&o.hostPaths, "hostpath", nil, "Host paths to be mounted")
-	cmd.Flags().StringSliceVar(&o.envs, "env", nil, "Environment variables")
-	cmd.Flags().BoolVar(&o.useHttpProxy, "use-proxy", false, "If set, use current HTTP proxy settings.")
-	cmd.Flags().StringVar(&o.distro, "distro", "",
+	cmd.Flags().StringVar(&o.Name, "name", "", "App name")
+	cmd.Flags().StringVar(&o.Image, "image", "", "Image the app uses")
+	cmd.Flags().StringVar(&o.Dockerfile, "dockerfile", "", "Dockerfile to build image that the app uses")
+	cmd.Flags().StringSliceVar(&o.HostPaths, "hostpath", nil, "Host paths to be mounted")
+	cmd.Flags().StringSliceVar(&o.Env, "env", nil, "Environment variables")
+	cmd.Flags().BoolVar(&o.UseProxy, "use-proxy", false, "If set, use current HTTP proxy settings.")
+	cmd.Flags().StringVar(&o.Distro, "distro", "",
 		"Linux distro that the app prefer. The default value is alpine.")
-	cmd.Flags().StringVar(&o.shell, "shell", "",
+	cmd.Flags().StringVar(&o.Shell, "shell", "",
 		"The shell you prefer. The default value is bash. You can also use zsh instead.")
+	cmd.Flags().StringVar(&o.Workdir, "workdir", "",
+		"Default mode to share the local working directory with the app, one of none, push, or sync. "+
+			"See \"kubectl dev app -h\" for details.")
+	cmd.Flags().StringSliceVar(&o.catalogs, "catalog", nil,
+		"Catalogs to look up the app instead of the default ones. Could be local paths, HTTP URLs, or git repositories.")
 	cmd.Flags().StringVar(&o.shortcutRoot, "install-base", o.shortcutRoot,
-		"Directory where app to be installed. It should be one of the PATH.")
+		"Directory where app shortcuts to be installed. It should be one of the PATH. "+
+			"The default value is $XDG_BIN_HOME, or ~/.local/bin if not set.")
 	o.AddPersistentFlags(cmd.Flags())
 
 	return cmd
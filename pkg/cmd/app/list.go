@@ -2,23 +2,30 @@ package app
 
 import (
 	"context"
+	"fmt"
 	"github.com/spf13/cobra"
 	appcorev1 "github.com/warm-metal/cliapp/pkg/apis/cliapp/v1"
 	appv1 "github.com/warm-metal/cliapp/pkg/clientset/versioned"
 	"github.com/warm-metal/kubectl-dev/pkg/cmd/opts"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 	"k8s.io/apimachinery/pkg/fields"
-	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/util/duration"
 	"k8s.io/cli-runtime/pkg/genericclioptions"
 	"k8s.io/cli-runtime/pkg/printers"
+	"sort"
+	"strings"
+	"time"
 )
 
 type appListOptions struct {
 	*opts.GlobalOptions
 	genericclioptions.IOStreams
+	shortcutInstallOptions
 
 	name      string
 	namespace string
+	output    string
 }
 
 func (o *appListOptions) Complete(cmd *cobra.Command, args []string) error {
@@ -26,11 +33,20 @@ func (o *appListOptions) Complete(cmd *cobra.Command, args []string) error {
 		o.name = args[0]
 	}
 
-	return nil
+	if o.Raw().Namespace != nil && len(*o.Raw().Namespace) > 0 {
+		o.namespace = *o.Raw().Namespace
+	}
+
+	return o.shortcutInstallOptions.expand()
 }
 
 func (o *appListOptions) Validate() error {
-	return nil
+	switch o.output {
+	case "", "wide", "json", "yaml", "name":
+		return nil
+	default:
+		return fmt.Errorf("output format must be one of wide, json, yaml, or name if set")
+	}
 }
 
 func (o *appListOptions) Run(ctx context.Context) error {
@@ -54,41 +70,192 @@ func (o *appListOptions) Run(ctx context.Context) error {
 		return err
 	}
 
+	shortcuts, err := o.listShortcuts()
+	if err != nil {
+		return err
+	}
+
+	if err = o.print(apps, shortcuts); err != nil {
+		return err
+	}
+
+	o.warnOrphanShortcuts(apps, shortcuts)
+	return nil
+}
+
+func (o *appListOptions) print(apps *appcorev1.CliAppList, shortcuts map[string]localShortcut) error {
+	// Objects fetched via clientsets have no type meta, which is required by printers.
+	apps.SetGroupVersionKind(appcorev1.GroupVersion.WithKind("CliAppList"))
+	for i := range apps.Items {
+		apps.Items[i].SetGroupVersionKind(appcorev1.GroupVersion.WithKind("CliApp"))
+	}
+
+	var obj runtime.Object = apps
+	if len(o.name) > 0 && len(apps.Items) == 1 {
+		obj = &apps.Items[0]
+	}
+
+	switch o.output {
+	case "json":
+		return (&printers.JSONPrinter{}).PrintObj(obj, o.Out)
+	case "yaml":
+		return (&printers.YAMLPrinter{}).PrintObj(obj, o.Out)
+	case "name":
+		printer := &printers.NamePrinter{}
+		for i := range apps.Items {
+			if err := printer.PrintObj(&apps.Items[i], o.Out); err != nil {
+				return err
+			}
+		}
+
+		return nil
+	}
+
+	if len(apps.Items) == 0 {
+		if len(o.namespace) > 0 {
+			fmt.Fprintf(o.ErrOut, "No CliApps found in namespace %s.\n", o.namespace)
+		} else {
+			fmt.Fprintln(o.ErrOut, "No CliApps found.")
+		}
+
+		return nil
+	}
+
 	w := printers.GetNewTabWriter(o.Out)
-	printer := printers.NewTablePrinter(printers.PrintOptions{
-		WithNamespace: true,
-		WithKind:      true,
-		Wide:          true,
-		ShowLabels:    true,
-		Kind: schema.GroupKind{
-			Group: appcorev1.GroupVersion.Group,
-			Kind:  "CliApp",
-		},
-	})
+	defer w.Flush()
+
+	var columns []string
+	if len(o.namespace) == 0 {
+		columns = append(columns, "NAMESPACE")
+	}
+
+	columns = append(columns, "NAME", "PHASE", "TARGET", "IMAGE/DOCKERFILE", "SHORTCUT", "LAST TRANSITION")
+	if o.output == "wide" {
+		columns = append(columns, "POD", "COMMAND", "ERROR")
+	}
 
-	w.SetRememberedWidths(nil)
+	fmt.Fprintln(w, strings.Join(columns, "\t"))
 	for i := range apps.Items {
 		app := &apps.Items[i]
-		printer.PrintObj(app, w)
-		w.Flush()
+		var row []string
+		if len(o.namespace) == 0 {
+			row = append(row, app.Namespace)
+		}
+
+		row = append(row, app.Name, valueOrNone(string(app.Status.Phase)), valueOrNone(string(app.Spec.TargetPhase)),
+			imageOrDockerfile(definedImage(app), app.Spec.Dockerfile), shortcutStatus(app, shortcuts),
+			translateTimestampSince(app.Status.LastPhaseTransition))
+		if o.output == "wide" {
+			row = append(row, valueOrNone(app.Status.PodName), valueOrNone(strings.Join(app.Spec.Command, " ")),
+				valueOrNone(app.Status.Error))
+		}
+
+		fmt.Fprintln(w, strings.Join(row, "\t"))
 	}
 
 	return nil
 }
 
+// warnOrphanShortcuts prints shortcuts which point to apps that don't exist.
+// Only shortcuts in the scope of the listing are checked.
+func (o *appListOptions) warnOrphanShortcuts(apps *appcorev1.CliAppList, shortcuts map[string]localShortcut) {
+	existing := make(map[string]bool, len(apps.Items))
+	for i := range apps.Items {
+		existing[apps.Items[i].Namespace+"/"+apps.Items[i].Name] = true
+	}
+
+	var orphans []localShortcut
+	for _, shortcut := range shortcuts {
+		if (len(o.namespace) > 0 && shortcut.namespace != o.namespace) || (len(o.name) > 0 && shortcut.name != o.name) {
+			continue
+		}
+
+		if !existing[shortcut.namespace+"/"+shortcut.name] {
+			orphans = append(orphans, shortcut)
+		}
+	}
+
+	sort.Slice(orphans, func(i, j int) bool {
+		return orphans[i].name < orphans[j].name
+	})
+
+	for _, shortcut := range orphans {
+		fmt.Fprintf(o.ErrOut, "Warning: shortcut \"%s\" points to app \"%s/%s\" which doesn't exist. "+
+			"Reinstall the app, or remove the shortcut via \"kubectl dev app uninstall -n %s %s\".\n",
+			shortcut.name, shortcut.namespace, shortcut.name, shortcut.namespace, shortcut.name)
+	}
+}
+
+// shortcutStatus tells whether the local shortcut of the app exists and points to it.
+func shortcutStatus(app *appcorev1.CliApp, shortcuts map[string]localShortcut) string {
+	shortcut, found := shortcuts[app.Name]
+	switch {
+	case !found:
+		return "none"
+	case shortcut.namespace != app.Namespace:
+		return fmt.Sprintf("points to %s/%s", shortcut.namespace, shortcut.name)
+	case !shortcut.linked:
+		return "not linked"
+	default:
+		return "installed"
+	}
+}
+
+// imageOrDockerfile returns the Dockerfile if set, or the image. Dockerfile contents are abbreviated.
+func imageOrDockerfile(image, dockerfile string) string {
+	if len(dockerfile) == 0 {
+		return image
+	}
+
+	if strings.Contains(dockerfile, "\n") {
+		return "<Dockerfile>"
+	}
+
+	return dockerfile
+}
+
+func valueOrNone(v string) string {
+	if len(v) == 0 {
+		return "<none>"
+	}
+
+	return v
+}
+
+func translateTimestampSince(timestamp metav1.Time) string {
+	if timestamp.IsZero() {
+		return "<unknown>"
+	}
+
+	return duration.HumanDuration(time.Since(timestamp.Time))
+}
+
 func newAppListCmd(opts *opts.GlobalOptions, streams genericclioptions.IOStreams) *cobra.Command {
 	o := &appListOptions{
-		GlobalOptions: opts,
-		IOStreams:     streams,
-		namespace:     metav1.NamespaceAll,
+		GlobalOptions:          opts,
+		IOStreams:              streams,
+		namespace:              metav1.NamespaceAll,
+		shortcutInstallOptions: initShortcutInstallOptions(),
 	}
 
 	var cmd = &cobra.Command{
-		Use:   "list",
+		Use:   "list [name]",
 		Short: "List all installed CliApps.",
-		Long:  `List all installed CliApps in the cluster.`,
-		Example: `# List all CliApps
+		Long: `List all installed CliApps in the cluster, in the namespace specified via "-n", or in all namespaces if not set.
+Column SHORTCUT shows the local shortcut of each app, one of
+  installed: the shortcut points to the app and is linked in the install base;
+  not linked: the shortcut points to the app but isn't linked in the install base;
+  points to <namespace>/<name>: the shortcut points to the app of the same name in another namespace;
+  none: no shortcut found.
+Shortcuts pointing to apps which don't exist are also reported.`,
+		Example: `# List all CliApps in namespace app
 kubectl dev app list -n app
+
+# Show Pods, commands, and errors of all CliApps
+kubectl dev app list -o wide
+
+# Print CliApp ctr in YAML
+kubectl dev app list ctr -o yaml
 `,
 		SilenceUsage: true,
 		RunE: func(cmd *cobra.Command, args []string) error {
@@ -106,6 +273,10 @@ kubectl dev app list -n app
 		},
 	}
 
+	cmd.Flags().StringVarP(&o.output, "output", "o", "", "Output format. One of wide, json, yaml, or name.")
+	cmd.Flags().StringVar(&o.shortcutRoot, "install-base", o.shortcutRoot,
+		"Directory where app shortcuts are installed. "+
+			"The default value is $XDG_BIN_HOME, or ~/.local/bin if not set.")
 	o.AddPersistentFlags(cmd.Flags())
 	return cmd
 }
@@ -0,0 +1,320 @@
+package app
+
+import (
+	"context"
+	"fmt"
+	appcorev1 "github.com/warm-metal/cliapp/pkg/apis/cliapp/v1"
+	appv1 "github.com/warm-metal/cliapp/pkg/clientset/versioned"
+	"github.com/warm-metal/kubectl-dev/pkg/utils"
+	"io"
+	"io/ioutil"
+	"k8s.io/apimachinery/pkg/api/equality"
+	"k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"os"
+	"path/filepath"
+	"sigs.k8s.io/yaml"
+)
+
+// appliedLabel marks CliApps created by "app apply". Only these apps are pruned.
+const appliedLabel = "cliapp.kubectl-dev.warm-metal.tech/applied"
+
+// appDefinition is the local definition of a CliApp, via either flags of "app install" or an app manifest.
+type appDefinition struct {
+	Name       string   `json:"name"`
+	Namespace  string   `json:"namespace,omitempty"`
+	Image      string   `json:"image,omitempty"`
+	Dockerfile string   `json:"dockerfile,omitempty"`
+	Command    []string `json:"command,omitempty"`
+	Env        []string `json:"env,omitempty"`
+	HostPaths  []string `json:"hostpaths,omitempty"`
+	Distro     string   `json:"distro,omitempty"`
+	Shell      string   `json:"shell,omitempty"`
+	UseProxy   bool     `json:"useProxy,omitempty"`
+	Workdir    string   `json:"workdir,omitempty"`
+}
+
+// appManifest is a list of CliApps to be installed together.
+type appManifest struct {
+	Apps []appDefinition `json:"apps"`
+}
+
+// loadManifest reads an app manifest from the file, or from the reader if the file is "-".
+func loadManifest(file string, in io.Reader) (*appManifest, error) {
+	var bytes []byte
+	var err error
+	if file == "-" {
+		bytes, err = ioutil.ReadAll(in)
+	} else {
+		bytes, err = ioutil.ReadFile(utils.ExpandTilde(file))
+	}
+
+	if err != nil {
+		return nil, fmt.Errorf(`can't read manifest "%s": %s`, file, err)
+	}
+
+	manifest := &appManifest{}
+	if err = yaml.UnmarshalStrict(bytes, manifest); err != nil {
+		return nil, fmt.Errorf(`invalid manifest "%s": %s`, file, err)
+	}
+
+	return manifest, nil
+}
+
+// toCliApp validates the definition and builds the CliApp object.
+// The namespace is used if the definition doesn't declare one.
+func (d *appDefinition) toCliApp(namespace string) (*appcorev1.CliApp, error) {
+	if len(d.Name) == 0 {
+		return nil, fmt.Errorf("app name is required")
+	}
+
+	if len(d.Image) > 0 && len(d.Dockerfile) > 0 {
+		return nil, fmt.Errorf(`app "%s": only one of image and dockerfile can be set`, d.Name)
+	}
+
+	if len(d.Namespace) > 0 {
+		namespace = d.Namespace
+	}
+
+	app := &appcorev1.CliApp{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      d.Name,
+			Namespace: namespace,
+		},
+		Spec: appcorev1.CliAppSpec{
+			Image:       d.Image,
+			Dockerfile:  d.Dockerfile,
+			Command:     d.Command,
+			HostPath:    d.HostPaths,
+			Env:         append([]string(nil), d.Env...),
+			TargetPhase: appcorev1.CliAppPhaseRest,
+		},
+	}
+
+	if len(app.Spec.Command) == 0 {
+		app.Spec.Command = []string{d.Name}
+	}
+
+	if len(d.Distro) > 0 {
+		distro, err := utils.ValidateDistro(d.Distro)
+		if err != nil {
+			return nil, fmt.Errorf(`app "%s": %s`, d.Name, err)
+		}
+
+		app.Spec.Distro = distro
+	}
+
+	if len(d.Shell) > 0 {
+		shell, err := utils.ValidateShell(d.Shell)
+		if err != nil {
+			return nil, fmt.Errorf(`app "%s": %s`, d.Name, err)
+		}
+
+		app.Spec.Shell = shell
+	}
+
+	if d.UseProxy {
+		proxies, err := utils.GetSysProxyEnvs()
+		if err != nil {
+			return nil, err
+		}
+		app.Spec.Env = append(app.Spec.Env, proxies...)
+	}
+
+	if len(d.Workdir) > 0 {
+		if err := validateWorkdirMode(d.Workdir); err != nil {
+			return nil, fmt.Errorf(`app "%s": %s`, d.Name, err)
+		}
+
+		app.Annotations = map[string]string{workdirAnnotation: d.Workdir}
+	}
+
+	return app, nil
+}
+
+// applyCliApp creates the app or updates the spec of the existing one.
+// It returns what has been done, one of "created", "configured", or "unchanged".
+func applyCliApp(ctx context.Context, appClient appv1.Interface, app *appcorev1.CliApp) (string, error) {
+	apps := appClient.CliappV1().CliApps(app.Namespace)
+	current, err := apps.Get(ctx, app.Name, metav1.GetOptions{})
+	if err != nil {
+		if !errors.IsNotFound(err) {
+			return "", err
+		}
+
+		if _, err = apps.Create(ctx, app, metav1.CreateOptions{}); err != nil {
+			return "", err
+		}
+
+		return "created", nil
+	}
+
+	labelsChanged := false
+	for k, v := range app.Labels {
+		if current.Labels[k] != v {
+			labelsChanged = true
+			break
+		}
+	}
+
+	// Annotations maintained by kubectl-dev are replaced as a whole.
+	annotationsChanged := false
+	for _, k := range []string{workdirAnnotation} {
+		if current.Annotations[k] != app.Annotations[k] {
+			annotationsChanged = true
+			if current.Annotations == nil {
+				current.Annotations = map[string]string{}
+			}
+
+			if v, found := app.Annotations[k]; found {
+				current.Annotations[k] = v
+			} else {
+				delete(current.Annotations, k)
+			}
+		}
+	}
+
+	// TargetPhase is maintained by app sessions, so it is not compared.
+	// Images pinned by "app upgrade" or built from Dockerfiles are compared with the defined ones.
+	imageChanged := definedImage(current) != app.Spec.Image || current.Spec.Dockerfile != app.Spec.Dockerfile
+	specChanged := imageChanged ||
+		!equality.Semantic.DeepEqual(current.Spec.Command, app.Spec.Command) ||
+		!equality.Semantic.DeepEqual(current.Spec.HostPath, app.Spec.HostPath) ||
+		!equality.Semantic.DeepEqual(current.Spec.Env, app.Spec.Env) ||
+		current.Spec.Distro != app.Spec.Distro ||
+		current.Spec.Shell != app.Spec.Shell
+	if !labelsChanged && !annotationsChanged && !specChanged {
+		return "unchanged", nil
+	}
+
+	if current.Labels == nil {
+		current.Labels = map[string]string{}
+	}
+
+	for k, v := range app.Labels {
+		current.Labels[k] = v
+	}
+
+	if specChanged {
+		// Apps being used by sessions keep running.
+		image, targetPhase := current.Spec.Image, current.Spec.TargetPhase
+		current.Spec = app.Spec
+		current.Spec.TargetPhase = targetPhase
+		if imageChanged {
+			delete(current.Annotations, imageAnnotation)
+			delete(current.Annotations, dockerfileDigestAnnotation)
+		} else {
+			current.Spec.Image = image
+		}
+	}
+
+	if _, err = apps.Update(ctx, current, metav1.UpdateOptions{}); err != nil {
+		return "", err
+	}
+
+	return "configured", nil
+}
+
+// fromCliApp returns the definition of the app, which can be applied to other clusters.
+// Images pinned by "app upgrade" or built from Dockerfiles are replaced by the defined ones.
+func fromCliApp(app *appcorev1.CliApp) appDefinition {
+	return appDefinition{
+		Name:       app.Name,
+		Namespace:  app.Namespace,
+		Image:      definedImage(app),
+		Dockerfile: app.Spec.Dockerfile,
+		Command:    app.Spec.Command,
+		Env:        app.Spec.Env,
+		HostPaths:  app.Spec.HostPath,
+		Distro:     string(app.Spec.Distro),
+		Shell:      string(app.Spec.Shell),
+		Workdir:    app.Annotations[workdirAnnotation],
+	}
+}
+
+// definitionPath returns where the definition of the app is saved along with its shortcut.
+func (o *shortcutInstallOptions) definitionPath(app string) string {
+	return filepath.Join(o.appRoot, "manifest", app+".yaml")
+}
+
+// saveDefinition saves the definition of the app, from which the app can be re-created if it is lost.
+func (o *shortcutInstallOptions) saveDefinition(app *appcorev1.CliApp) error {
+	bytes, err := yaml.Marshal(&appManifest{Apps: []appDefinition{fromCliApp(app)}})
+	if err != nil {
+		return err
+	}
+
+	path := o.definitionPath(app.Name)
+	if err = mkdirAll(filepath.Dir(path)); err != nil {
+		return err
+	}
+
+	if err = ioutil.WriteFile(path, bytes, 0644); err != nil {
+		return err
+	}
+
+	return chownToSudoer(path)
+}
+
+// loadDefinition returns the saved definition of the app, or nil if not found.
+func (o *shortcutInstallOptions) loadDefinition(app string) (*appDefinition, error) {
+	path := o.definitionPath(app)
+	if _, err := os.Stat(path); os.IsNotExist(err) {
+		return nil, nil
+	}
+
+	manifest, err := loadManifest(path, nil)
+	if err != nil {
+		return nil, err
+	}
+
+	for i := range manifest.Apps {
+		if manifest.Apps[i].Name == app {
+			return &manifest.Apps[i], nil
+		}
+	}
+
+	return nil, nil
+}
+
+// applyApp applies the app, then installs its shortcut and saves its definition.
+// It returns what has been done to the app, the same as applyCliApp.
+func (o *shortcutInstallOptions) applyApp(
+	ctx context.Context, appClient appv1.Interface, app *appcorev1.CliApp, errOut io.Writer,
+) (string, error) {
+	result, err := applyCliApp(ctx, appClient, app)
+	if err != nil {
+		return "", fmt.Errorf(`can't apply app "%s/%s": %s`, app.Namespace, app.Name, err)
+	}
+
+	shortcut := *o
+	if err = shortcut.init(app.Name); err != nil {
+		return "", err
+	}
+
+	if err = shortcut.installShortcut(app.Name, app.Namespace); err != nil {
+		return "", fmt.Errorf(`can't install shortcut of app "%s/%s": %s`, app.Namespace, app.Name, err)
+	}
+
+	if err = shortcut.saveDefinition(app); err != nil {
+		return "", fmt.Errorf(`can't save definition of app "%s/%s": %s`, app.Namespace, app.Name, err)
+	}
+
+	shortcut.warnLegacyShortcut(errOut, app.Name)
+	return result, nil
+}
+
+// validateUniqueNames checks whether app names are unique.
+// Shortcuts are named after apps, so app names must be unique even across namespaces.
+func validateUniqueNames(apps []*appcorev1.CliApp) error {
+	names := make(map[string]string, len(apps))
+	for _, app := range apps {
+		if ns, found := names[app.Name]; found {
+			return fmt.Errorf(`app "%s" is declared in both namespace "%s" and "%s"`, app.Name, ns, app.Namespace)
+		}
+
+		names[app.Name] = app.Namespace
+	}
+
+	return nil
+}
@@ -0,0 +1,109 @@
+package app
+
+import (
+	"context"
+	"fmt"
+	"github.com/spf13/cobra"
+	"github.com/warm-metal/kubectl-dev/pkg/cmd/opts"
+	"k8s.io/cli-runtime/pkg/genericclioptions"
+	"os"
+	"path/filepath"
+	"sort"
+)
+
+type appMigrateOptions struct {
+	*opts.GlobalOptions
+	genericclioptions.IOStreams
+	shortcutInstallOptions
+}
+
+func (o *appMigrateOptions) Complete(cmd *cobra.Command, args []string) error {
+	if len(args) > 0 {
+		cmd.SilenceUsage = false
+		return fmt.Errorf("invalid arguments")
+	}
+
+	return o.prepare()
+}
+
+func (o *appMigrateOptions) Validate() error {
+	return nil
+}
+
+func (o *appMigrateOptions) Run(ctx context.Context) error {
+	shortcuts, err := o.listShortcuts()
+	if err != nil {
+		return err
+	}
+
+	names := make([]string, 0, len(shortcuts))
+	for name := range shortcuts {
+		names = append(names, name)
+	}
+
+	sort.Strings(names)
+	migrated := 0
+	for _, name := range names {
+		namespace := shortcuts[name].namespace
+		shortcut := o.shortcutInstallOptions
+		shortcut.appPath = filepath.Join(o.appRoot, name)
+		shortcut.shortcutPath = filepath.Join(o.shortcutRoot, name)
+		if err = os.Remove(shortcut.appPath); err != nil {
+			return fmt.Errorf(`can't update shortcut "%s": %s. Run the command via "sudo -E"`, shortcut.appPath, err)
+		}
+
+		if err = shortcut.installShortcut(name, namespace); err != nil {
+			return err
+		}
+
+		if legacy, err := shortcut.removeLegacyShortcut(name); err != nil {
+			return fmt.Errorf(`can't remove "%s": %s. Run the command via "sudo -E"`, legacy, err)
+		}
+
+		fmt.Fprintf(o.Out, "%s -> %s\n", shortcut.shortcutPath, shortcut.appPath)
+		migrated++
+	}
+
+	fmt.Fprintf(o.Out, "Migrated %d apps\n", migrated)
+	o.printPathHint(o.ErrOut)
+	return nil
+}
+
+func newAppMigrateCmd(opts *opts.GlobalOptions, streams genericclioptions.IOStreams) *cobra.Command {
+	o := &appMigrateOptions{
+		GlobalOptions:          opts,
+		IOStreams:              streams,
+		shortcutInstallOptions: initShortcutInstallOptions(),
+	}
+
+	var cmd = &cobra.Command{
+		Use:   "migrate",
+		Short: "Move shortcuts of CliApps to the per-user install base.",
+		Long: `Earlier versions installed shortcuts of CliApps to /usr/local/bin via sudo, and left root-owned files in
+~/.cliapps. This command regenerates all shortcuts in ~/.cliapps, links them in the new install base, removes the
+legacy links in /usr/local/bin, and gives all these files back to the user who runs sudo.
+After that, apps can be installed or uninstalled without sudo.`,
+		Example: `# Migrate shortcuts installed via sudo
+sudo -E kubectl dev app migrate
+`,
+		SilenceUsage: true,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			if err := o.Complete(cmd, args); err != nil {
+				return err
+			}
+			if err := o.Validate(); err != nil {
+				return err
+			}
+			if err := o.Run(cmd.Context()); err != nil {
+				return err
+			}
+
+			return nil
+		},
+	}
+
+	cmd.Flags().StringVar(&o.shortcutRoot, "install-base", o.shortcutRoot,
+		"Directory where app shortcuts to be installed. It should be one of the PATH. "+
+			"The default value is $XDG_BIN_HOME, or ~/.local/bin if not set.")
+	return cmd
+}
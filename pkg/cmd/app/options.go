@@ -3,12 +3,23 @@ package app
 import (
 	"fmt"
 	"github.com/warm-metal/kubectl-dev/pkg/utils"
+	"golang.org/x/sys/unix"
+	"io"
 	"io/ioutil"
 	"os"
 	"path/filepath"
+	"regexp"
+	"strconv"
 	"strings"
 )
 
+const (
+	// legacyShortcutRoot is where shortcuts were installed by earlier versions. It requires the root privilege.
+	legacyShortcutRoot = "/usr/local/bin"
+
+	defaultAppRoot = "~/.cliapps"
+)
+
 type shortcutInstallOptions struct {
 	shortcutRoot string
 	appRoot      string
@@ -18,38 +29,77 @@ type shortcutInstallOptions struct {
 
 func initShortcutInstallOptions() shortcutInstallOptions {
 	return shortcutInstallOptions{
-		shortcutRoot: "/usr/local/bin",
-		appRoot:      "~/.cliapps",
+		shortcutRoot: utils.UserBinDir(),
+		appRoot:      defaultAppRoot,
 	}
 }
 
-func (o *shortcutInstallOptions) init(app string) error {
+// expand converts the install base and the app root to clean absolute paths.
+func (o *shortcutInstallOptions) expand() error {
 	if len(o.shortcutRoot) == 0 {
 		return fmt.Errorf("install-base not set")
 	}
 
-	if path, found := os.LookupEnv("PATH"); !found || strings.Index(path, o.shortcutRoot) < 0 {
-		return fmt.Errorf("install-base not found in PATH")
+	o.shortcutRoot = filepath.Clean(utils.ExpandTilde(o.shortcutRoot))
+	o.appRoot = filepath.Clean(utils.ExpandTilde(o.appRoot))
+	return nil
+}
+
+// prepare creates the install base and the app root.
+func (o *shortcutInstallOptions) prepare() error {
+	if err := o.expand(); err != nil {
+		return err
+	}
+
+	if err := mkdirAll(o.shortcutRoot); err != nil {
+		return err
+	}
+
+	if err := mkdirAll(o.appRoot); err != nil {
+		return err
+	}
+
+	return chownToSudoer(o.shortcutRoot, o.appRoot)
+}
+
+// mkdirAll creates the directory along with its parents. Directories created are owned by the user who runs sudo.
+func mkdirAll(dir string) error {
+	var created []string
+	for parent := dir; ; parent = filepath.Dir(parent) {
+		if _, err := os.Stat(parent); err == nil || parent == filepath.Dir(parent) {
+			break
+		}
+
+		created = append(created, parent)
 	}
 
-	o.shortcutRoot = utils.ExpandTilde(o.shortcutRoot)
-	if err := os.MkdirAll(o.shortcutRoot, 0755); err != nil {
+	if err := os.MkdirAll(dir, 0755); err != nil {
 		return err
 	}
 
-	o.appRoot = utils.ExpandTilde(o.appRoot)
-	if err := os.MkdirAll(o.appRoot, 0755); err != nil {
+	return chownToSudoer(created...)
+}
+
+func (o *shortcutInstallOptions) init(app string) error {
+	if err := o.prepare(); err != nil {
 		return err
 	}
 
+	if err := unix.Access(o.appRoot, unix.W_OK); err != nil {
+		return fmt.Errorf(`"%s" is not writable, which may be created via sudo. `+
+			`Run "sudo -E kubectl dev app migrate" to take it over`, o.appRoot)
+	}
+
 	o.appPath = filepath.Join(o.appRoot, app)
 	o.shortcutPath = filepath.Join(o.shortcutRoot, app)
 	return nil
 }
 
-const appShortcut = `#!/usr/bin/env bash
-
-kubectl-dev app -n %s --name %s -- $@`
+// appShortcut runs the app with all arguments as is. The exit code of the app is also the one of the shortcut.
+const appShortcut = `#!/bin/sh
+# Generated by kubectl-dev. Reinstall the app to update it.
+exec kubectl-dev app -n %s --name %s -- "$@"
+`
 
 func (o *shortcutInstallOptions) installShortcut(app, namespace string) error {
 	for _, path := range []string{o.appPath, o.shortcutPath} {
@@ -59,7 +109,7 @@ func (o *shortcutInstallOptions) installShortcut(app, namespace string) error {
 		}
 	}
 
-	bootstrap := fmt.Sprintf(appShortcut, namespace, app)
+	bootstrap := fmt.Sprintf(appShortcut, utils.ShellQuote(namespace), utils.ShellQuote(app))
 	if err := ioutil.WriteFile(o.appPath, []byte(bootstrap), 0755); err != nil {
 		return err
 	}
@@ -73,7 +123,7 @@ func (o *shortcutInstallOptions) installShortcut(app, namespace string) error {
 		return err
 	}
 
-	return nil
+	return chownToSudoer(o.appPath, o.shortcutPath)
 }
 
 func (o *shortcutInstallOptions) uninstallShortcut() error {
@@ -85,5 +135,173 @@ func (o *shortcutInstallOptions) uninstallShortcut() error {
 		return err
 	}
 
+	if err := os.Remove(o.definitionPath(filepath.Base(o.appPath))); err != nil && !os.IsNotExist(err) {
+		return err
+	}
+
+	return o.removeCompletions(filepath.Base(o.appPath))
+}
+
+// shortcutApp matches the app namespace and name in shortcuts generated by any version.
+var shortcutApp = regexp.MustCompile(`kubectl-dev app -n ('[^']*'|\S+) --name ('[^']*'|\S+) --`)
+
+// localShortcut is a shortcut in the app root.
+type localShortcut struct {
+	name      string
+	namespace string
+
+	// linked is true if the shortcut is linked in the install base or the legacy one.
+	linked bool
+}
+
+// listShortcuts returns shortcuts generated by kubectl-dev in the app root, keyed by app names.
+func (o *shortcutInstallOptions) listShortcuts() (map[string]localShortcut, error) {
+	files, err := ioutil.ReadDir(o.appRoot)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil, nil
+		}
+
+		return nil, err
+	}
+
+	shortcuts := make(map[string]localShortcut, len(files))
+	for _, file := range files {
+		if !file.Mode().IsRegular() {
+			continue
+		}
+
+		appPath := filepath.Join(o.appRoot, file.Name())
+		bytes, err := ioutil.ReadFile(appPath)
+		if err != nil {
+			return nil, err
+		}
+
+		matches := shortcutApp.FindStringSubmatch(string(bytes))
+		if matches == nil {
+			continue
+		}
+
+		shortcut := localShortcut{name: strings.Trim(matches[2], "'"), namespace: strings.Trim(matches[1], "'")}
+		if shortcut.name != file.Name() {
+			continue
+		}
+
+		for _, root := range []string{o.shortcutRoot, legacyShortcutRoot} {
+			if target, err := os.Readlink(filepath.Join(root, shortcut.name)); err == nil && filepath.Clean(target) == appPath {
+				shortcut.linked = true
+				break
+			}
+		}
+
+		shortcuts[shortcut.name] = shortcut
+	}
+
+	return shortcuts, nil
+}
+
+// removeLegacyShortcut removes the shortcut of the app in the legacy install base if it links to the app root.
+// It returns the path of the legacy shortcut if it can't be removed.
+func (o *shortcutInstallOptions) removeLegacyShortcut(app string) (string, error) {
+	legacy := filepath.Join(legacyShortcutRoot, app)
+	if legacy == o.shortcutPath {
+		return "", nil
+	}
+
+	target, err := os.Readlink(legacy)
+	if err != nil || filepath.Clean(target) != filepath.Join(o.appRoot, app) {
+		return "", nil
+	}
+
+	if err = os.Remove(legacy); err != nil && !os.IsNotExist(err) {
+		return legacy, err
+	}
+
+	return "", nil
+}
+
+// warnLegacyShortcut removes the legacy shortcut, and prints a warning if it fails.
+func (o *shortcutInstallOptions) warnLegacyShortcut(w io.Writer, app string) {
+	if legacy, err := o.removeLegacyShortcut(app); err != nil {
+		fmt.Fprintf(w, "Warning: unable to remove the legacy shortcut \"%s\": %s.\n"+
+			"Run \"sudo -E kubectl dev app migrate\" to remove it.\n", legacy, err)
+	}
+}
+
+// inPath returns true if the directory is exactly one of the entries in PATH.
+func inPath(dir string) bool {
+	for _, entry := range filepath.SplitList(os.Getenv("PATH")) {
+		if len(entry) > 0 && filepath.Clean(utils.ExpandTilde(entry)) == dir {
+			return true
+		}
+	}
+
+	return false
+}
+
+// printPathHint prints the shell snippet to add the install base to PATH if it isn't in PATH.
+func (o *shortcutInstallOptions) printPathHint(w io.Writer) {
+	if inPath(o.shortcutRoot) {
+		return
+	}
+
+	rc, snippet := o.pathSnippet()
+	fmt.Fprintf(w, "\"%s\" is not in PATH. Add the line below to %s, then restart your shell.\n\n    %s\n\n",
+		o.shortcutRoot, rc, snippet)
+}
+
+// pathSnippet returns the shell snippet to add the install base to PATH, and the rc file of the shell to put it in.
+func (o *shortcutInstallOptions) pathSnippet() (rc, snippet string) {
+	dir := o.shortcutRoot
+	if home, err := os.UserHomeDir(); err == nil && strings.HasPrefix(dir, home+string(filepath.Separator)) {
+		dir = "$HOME" + strings.TrimPrefix(dir, home)
+	}
+
+	rc, snippet = "~/.profile", fmt.Sprintf(`export PATH="%s:$PATH"`, dir)
+	switch filepath.Base(os.Getenv("SHELL")) {
+	case "zsh":
+		rc = "~/.zshrc"
+	case "bash":
+		rc = "~/.bashrc"
+	case "fish":
+		rc, snippet = "~/.config/fish/config.fish", fmt.Sprintf(`fish_add_path "%s"`, dir)
+	}
+
+	return
+}
+
+// chownToSudoer changes the owner of files to the user who runs sudo, such that they can be updated without sudo.
+// It does nothing if not running via sudo.
+func chownToSudoer(paths ...string) error {
+	if os.Geteuid() != 0 {
+		return nil
+	}
+
+	uid, err := strconv.Atoi(os.Getenv("SUDO_UID"))
+	if err != nil {
+		return nil
+	}
+
+	gid, err := strconv.Atoi(os.Getenv("SUDO_GID"))
+	if err != nil {
+		return nil
+	}
+
+	home, err := os.UserHomeDir()
+	if err != nil {
+		return nil
+	}
+
+	for _, path := range paths {
+		// Only files in the home directory of the user are touched.
+		if !strings.HasPrefix(path, home+string(filepath.Separator)) {
+			continue
+		}
+
+		if err = os.Lchown(path, uid, gid); err != nil {
+			return err
+		}
+	}
+
 	return nil
 }
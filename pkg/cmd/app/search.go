@@ -0,0 +1,129 @@
+package app
+
+import (
+	"context"
+	"fmt"
+	"github.com/spf13/cobra"
+	"github.com/warm-metal/kubectl-dev/pkg/cmd/opts"
+	"k8s.io/cli-runtime/pkg/genericclioptions"
+	"k8s.io/cli-runtime/pkg/printers"
+	"strings"
+)
+
+type appSearchOptions struct {
+	*opts.GlobalOptions
+	genericclioptions.IOStreams
+
+	keyword  string
+	catalogs []string
+}
+
+func (o *appSearchOptions) Complete(cmd *cobra.Command, args []string) error {
+	if len(args) > 1 {
+		cmd.SilenceUsage = false
+		return fmt.Errorf("invalid arguments")
+	}
+
+	if len(args) > 0 {
+		o.keyword = strings.ToLower(args[0])
+	}
+
+	sources, err := loadCatalogSources(o.catalogs)
+	if err != nil {
+		return err
+	}
+
+	o.catalogs = sources
+	return nil
+}
+
+func (o *appSearchOptions) Validate() error {
+	return nil
+}
+
+func (o *appSearchOptions) Run(ctx context.Context) error {
+	w := printers.GetNewTabWriter(o.Out)
+	defer w.Flush()
+
+	fmt.Fprintln(w, "NAME\tIMAGE/DOCKERFILE\tCATALOG\tDESCRIPTION")
+	for _, source := range o.catalogs {
+		c, err := loadCatalog(ctx, source)
+		if err != nil {
+			return err
+		}
+
+		for _, entry := range c.Apps {
+			if len(o.keyword) > 0 && !strings.Contains(strings.ToLower(entry.Name), o.keyword) &&
+				!strings.Contains(strings.ToLower(entry.Description), o.keyword) {
+				continue
+			}
+
+			fmt.Fprintf(w, "%s\t%s\t%s\t%s\n",
+				entry.Name, imageOrDockerfile(entry.Image, entry.Dockerfile), source, entry.Description)
+		}
+	}
+
+	return nil
+}
+
+func newAppSearchCmd(opts *opts.GlobalOptions, streams genericclioptions.IOStreams) *cobra.Command {
+	o := &appSearchOptions{
+		GlobalOptions: opts,
+		IOStreams:     streams,
+	}
+
+	var cmd = &cobra.Command{
+		Use:   "search [keyword]",
+		Short: "Search CliApps in catalogs.",
+		Long: `Search CliApps in catalogs by name or description. Apps found can be installed via their names.
+A catalog is a YAML index in a local directory, a git repository, or at an HTTP URL.
+Directories and git repositories should have the index "catalog.yaml" in their roots.
+Default catalogs are listed in "~/.kubectl-dev/catalog" as below.
+
+sources:
+- git+https://github.com/example/cliapps.git#main
+- https://example.com/cliapps/catalog.yaml
+- ~/cliapps
+
+An index is like below. Relative Dockerfile paths are resolved against the index.
+
+apps:
+- name: ctr
+  description: containerd CLI
+  image: docker.io/warmmetal/ctr:v1
+  command: [ctr]
+  env: [CONTAINERD_NAMESPACE=k8s.io]
+  hostpaths: [/var/run/containerd/containerd.sock]
+- name: crictl
+  dockerfile: crictl/Dockerfile
+  distro: ubuntu
+  shell: zsh`,
+		Example: `# List all apps in default catalogs
+kubectl dev app search
+
+# Search apps about containerd in a specific catalog
+kubectl dev app search containerd --catalog https://example.com/cliapps/catalog.yaml
+
+# Install an app in catalogs
+kubectl dev app install ctr
+`,
+		SilenceUsage: true,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			if err := o.Complete(cmd, args); err != nil {
+				return err
+			}
+			if err := o.Validate(); err != nil {
+				return err
+			}
+			if err := o.Run(cmd.Context()); err != nil {
+				return err
+			}
+
+			return nil
+		},
+	}
+
+	cmd.Flags().StringSliceVar(&o.catalogs, "catalog", nil,
+		"Catalogs to search instead of the default ones. Could be local paths, HTTP URLs, or git repositories.")
+	return cmd
+}
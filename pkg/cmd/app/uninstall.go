@@ -63,6 +63,7 @@ func (o *appUninstallOptions) Run(ctx context.Context) error {
 		return err
 	}
 
+	o.warnLegacyShortcut(o.ErrOut, o.name)
 	fmt.Println("Uninstalled")
 	return err
 }
@@ -99,7 +100,8 @@ kubectl dev app uninstall -n app ctr
 	}
 
 	cmd.Flags().StringVar(&o.shortcutRoot, "install-base", o.shortcutRoot,
-		"Directory where app to be installed. It should be one of the PATH.")
+		"Directory where app shortcuts to be installed. It should be one of the PATH. "+
+			"The default value is $XDG_BIN_HOME, or ~/.local/bin if not set.")
 	o.AddPersistentFlags(cmd.Flags())
 	return cmd
 }
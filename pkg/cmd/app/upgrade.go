@@ -0,0 +1,318 @@
+package app
+
+import (
+	"context"
+	"crypto/sha256"
+	"fmt"
+	"github.com/containerd/containerd/remotes"
+	"github.com/spf13/cobra"
+	appcorev1 "github.com/warm-metal/cliapp/pkg/apis/cliapp/v1"
+	appv1 "github.com/warm-metal/cliapp/pkg/clientset/versioned"
+	"github.com/warm-metal/kubectl-dev/pkg/cmd/opts"
+	"github.com/warm-metal/kubectl-dev/pkg/image"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/cli-runtime/pkg/genericclioptions"
+	"k8s.io/client-go/util/retry"
+	"strings"
+)
+
+const (
+	// imageAnnotation keeps the image reference of an app whose image has been pinned to a digest by "app upgrade".
+	imageAnnotation = "cliapp.kubectl-dev.warm-metal.tech/image"
+
+	// dockerfileDigestAnnotation keeps the digest of the Dockerfile from which the app image is built.
+	dockerfileDigestAnnotation = "cliapp.kubectl-dev.warm-metal.tech/dockerfile-digest"
+)
+
+// definedImage returns the image the app is defined with, rather than the pinned one or the one built.
+func definedImage(app *appcorev1.CliApp) string {
+	if len(app.Spec.Dockerfile) > 0 {
+		return ""
+	}
+
+	if ref, found := app.Annotations[imageAnnotation]; found {
+		return ref
+	}
+
+	return app.Spec.Image
+}
+
+// dockerfileDigest returns the digest of the Dockerfile content. URLs are fetched.
+func dockerfileDigest(ctx context.Context, dockerfile string) (string, error) {
+	content := []byte(dockerfile)
+	if strings.HasPrefix(dockerfile, "http://") || strings.HasPrefix(dockerfile, "https://") {
+		var err error
+		if content, err = fetchURL(ctx, dockerfile); err != nil {
+			return "", fmt.Errorf(`can't fetch Dockerfile "%s": %s`, dockerfile, err)
+		}
+	}
+
+	return fmt.Sprintf("sha256:%x", sha256.Sum256(content)), nil
+}
+
+// appUpgrade is the new version of an app.
+type appUpgrade struct {
+	image       string
+	annotations map[string]string
+	result      string
+}
+
+type appUpgradeOptions struct {
+	*opts.GlobalOptions
+	genericclioptions.IOStreams
+
+	name      string
+	namespace string
+	all       bool
+	rebuild   bool
+	dryRun    bool
+
+	// marked is the number of apps marked for rebuild.
+	marked int
+}
+
+func (o *appUpgradeOptions) Complete(cmd *cobra.Command, args []string) error {
+	if len(args) > 1 || (len(args) == 1) == o.all {
+		cmd.SilenceUsage = false
+		return fmt.Errorf("specify either an app name or --all")
+	}
+
+	if len(args) > 0 {
+		o.name = args[0]
+	}
+
+	if o.Raw().Namespace != nil && len(*o.Raw().Namespace) > 0 {
+		o.namespace = *o.Raw().Namespace
+	} else if len(o.name) > 0 {
+		o.namespace = metav1.NamespaceDefault
+	}
+
+	return nil
+}
+
+func (o *appUpgradeOptions) Validate() error {
+	return nil
+}
+
+func (o *appUpgradeOptions) Run(ctx context.Context) error {
+	conf, err := o.Raw().ToRESTConfig()
+	if err != nil {
+		return err
+	}
+
+	appClient, err := appv1.NewForConfig(conf)
+	if err != nil {
+		return err
+	}
+
+	var apps []appcorev1.CliApp
+	if o.all {
+		list, err := appClient.CliappV1().CliApps(o.namespace).List(ctx, metav1.ListOptions{})
+		if err != nil {
+			return err
+		}
+
+		apps = list.Items
+	} else {
+		app, err := appClient.CliappV1().CliApps(o.namespace).Get(ctx, o.name, metav1.GetOptions{})
+		if err != nil {
+			return err
+		}
+
+		apps = append(apps, *app)
+	}
+
+	resolver := image.NewResolver(o.ErrOut)
+	failed := 0
+	for i := range apps {
+		app := &apps[i]
+		result, err := o.upgrade(ctx, appClient, resolver, app)
+		if err != nil {
+			// Failures of an app don't stop upgrading others.
+			fmt.Fprintf(o.ErrOut, "can't upgrade app \"%s/%s\": %s\n", app.Namespace, app.Name, err)
+			failed++
+			continue
+		}
+
+		fmt.Fprintf(o.Out, "cliapp %s/%s %s\n", app.Namespace, app.Name, result)
+	}
+
+	if o.marked > 0 {
+		// The controller doesn't build images again for Dockerfiles it has built since it started.
+		fmt.Fprintf(o.ErrOut, "%d apps are marked for rebuild. Restart the controller to take effect via\n"+
+			"  kubectl -n cliapp-system rollout restart deploy/cliapp-controller-manager\n", o.marked)
+	}
+
+	if failed > 0 {
+		return fmt.Errorf("%d of %d apps failed to upgrade", failed, len(apps))
+	}
+
+	return nil
+}
+
+// checkUpgrade returns the new version of the app, or nil if the app is up to date.
+// Image tags are resolved to their latest digests, to which apps are pinned. Since images are pulled by digests,
+// the new version is pulled even if a stale one of the same tag has been pulled.
+// Apps using Dockerfiles are rebuilt if the Dockerfiles changed since the last upgrade.
+func (o *appUpgradeOptions) checkUpgrade(
+	ctx context.Context, resolver remotes.Resolver, app *appcorev1.CliApp,
+) (*appUpgrade, error) {
+	if app.Spec.Fork != nil {
+		return nil, nil
+	}
+
+	if len(app.Spec.Dockerfile) > 0 {
+		digest, err := dockerfileDigest(ctx, app.Spec.Dockerfile)
+		if err != nil {
+			return nil, err
+		}
+
+		if digest == app.Annotations[dockerfileDigestAnnotation] && !o.rebuild {
+			return nil, nil
+		}
+
+		return &appUpgrade{
+			annotations: map[string]string{dockerfileDigestAnnotation: digest},
+			result:      "marked for rebuild",
+		}, nil
+	}
+
+	ref := definedImage(app)
+	if len(ref) == 0 || image.IsDigested(ref) {
+		return nil, nil
+	}
+
+	name, desc, err := image.Resolve(ctx, resolver, ref)
+	if err != nil {
+		return nil, fmt.Errorf(`can't resolve image "%s": %s (%s)`, ref, err, image.GetPullErrorReason(err))
+	}
+
+	pinned, err := image.PinDigest(name, desc.Digest.String())
+	if err != nil {
+		return nil, err
+	}
+
+	if pinned == app.Spec.Image {
+		return nil, nil
+	}
+
+	return &appUpgrade{
+		image:       pinned,
+		annotations: map[string]string{imageAnnotation: ref},
+		result:      "upgraded to " + desc.Digest.String(),
+	}, nil
+}
+
+// upgrade updates the app to its new version if any, and returns what has been done.
+// Live apps are put to rest, such that the next session uses the new version. Open sessions are not interrupted.
+func (o *appUpgradeOptions) upgrade(
+	ctx context.Context, appClient appv1.Interface, resolver remotes.Resolver, app *appcorev1.CliApp,
+) (string, error) {
+	upgrade, err := o.checkUpgrade(ctx, resolver, app)
+	if err != nil {
+		return "", err
+	}
+
+	if upgrade == nil {
+		return "up to date", nil
+	}
+
+	if o.dryRun {
+		return upgrade.result + " (dry run)", nil
+	}
+
+	live := false
+	err = retry.RetryOnConflict(retry.DefaultRetry, func() error {
+		current, err := appClient.CliappV1().CliApps(app.Namespace).Get(ctx, app.Name, metav1.GetOptions{})
+		if err != nil {
+			return err
+		}
+
+		if current.Spec.Dockerfile != app.Spec.Dockerfile || definedImage(current) != definedImage(app) {
+			return fmt.Errorf("the app has been changed while upgrading")
+		}
+
+		// Images of apps using Dockerfiles are rebuilt once cleared.
+		current.Spec.Image = upgrade.image
+		if current.Annotations == nil {
+			current.Annotations = map[string]string{}
+		}
+
+		for k, v := range upgrade.annotations {
+			current.Annotations[k] = v
+		}
+
+		live = current.Spec.TargetPhase == appcorev1.CliAppPhaseLive ||
+			(current.Status.Phase != "" && current.Status.Phase != appcorev1.CliAppPhaseRest)
+		current.Spec.TargetPhase = appcorev1.CliAppPhaseRest
+		_, err = appClient.CliappV1().CliApps(app.Namespace).Update(ctx, current, metav1.UpdateOptions{})
+		return err
+	})
+	if err != nil {
+		return "", err
+	}
+
+	if len(upgrade.image) == 0 {
+		o.marked++
+	}
+
+	if live && len(upgrade.image) > 0 {
+		return upgrade.result + ", effective in the next session", nil
+	}
+
+	return upgrade.result, nil
+}
+
+func newAppUpgradeCmd(opts *opts.GlobalOptions, streams genericclioptions.IOStreams) *cobra.Command {
+	o := &appUpgradeOptions{
+		GlobalOptions: opts,
+		IOStreams:     streams,
+	}
+
+	var cmd = &cobra.Command{
+		Use:   "upgrade [OPTIONS] name|--all",
+		Short: "Upgrade CliApps to the latest version of their images or Dockerfiles.",
+		Long: `Check whether images of CliApps have new versions, then upgrade apps to them.
+For apps using images, the image tag is resolved to its latest digest in the registry, to which the app is pinned.
+Images are then pulled by digests, so stale images of the same tag on nodes are not used any more.
+Apps using images by digests are never upgraded.
+For apps using Dockerfiles, the Dockerfile content, or the one at the URL, is compared with the one of the last
+upgrade. Apps are marked for rebuild if they differ, or if no upgrade ever happened.
+
+Live apps are put to rest, and the new version is used in the next session.
+Apps can be upgraded with open sessions, which are not interrupted but remain on the current version.
+
+The controller reuses images it built since it started. So, apps marked for rebuild are rebuilt only after
+the controller is restarted via "kubectl -n cliapp-system rollout restart deploy/cliapp-controller-manager".`,
+		Example: `# Upgrade ctr in namespace default
+kubectl dev app upgrade ctr
+
+# Check whether there are new versions of apps in all namespaces, without upgrading them
+kubectl dev app upgrade --all --dry-run
+
+# Upgrade all apps in namespace app and rebuild all apps using Dockerfiles
+kubectl dev app upgrade -n app --all --rebuild
+`,
+		SilenceUsage: true,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			if err := o.Complete(cmd, args); err != nil {
+				return err
+			}
+			if err := o.Validate(); err != nil {
+				return err
+			}
+			if err := o.Run(cmd.Context()); err != nil {
+				return err
+			}
+
+			return nil
+		},
+	}
+
+	cmd.Flags().BoolVar(&o.all, "all", false,
+		`Upgrade all apps in the namespace specified via "-n", or in all namespaces if not set.`)
+	cmd.Flags().BoolVar(&o.rebuild, "rebuild", false, "Rebuild apps using Dockerfiles even if Dockerfiles don't change.")
+	cmd.Flags().BoolVar(&o.dryRun, "dry-run", false, "Only print apps to be upgraded.")
+	o.AddPersistentFlags(cmd.Flags())
+	return cmd
+}
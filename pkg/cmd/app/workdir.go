@@ -0,0 +1,480 @@
+package app
+
+import (
+	"archive/tar"
+	"bufio"
+	"bytes"
+	"context"
+	"fmt"
+	"github.com/docker/docker/pkg/fileutils"
+	appcorev1 "github.com/warm-metal/cliapp/pkg/apis/cliapp/v1"
+	appv1 "github.com/warm-metal/cliapp/pkg/clientset/versioned"
+	"github.com/warm-metal/kubectl-dev/pkg/kubectl"
+	"github.com/warm-metal/kubectl-dev/pkg/utils"
+	"io"
+	"io/ioutil"
+	"k8s.io/apimachinery/pkg/api/resource"
+	"os"
+	"path"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+const (
+	// workdirAnnotation keeps the default workdir mode of an app.
+	workdirAnnotation = "cliapp.kubectl-dev.warm-metal.tech/workdir"
+
+	workdirNone = "none"
+	workdirPush = "push"
+	workdirSync = "sync"
+
+	// Apps run in the app container after chroot to the app image mounted at /app-root.
+	appRoot = "/app-root"
+)
+
+func validateWorkdirMode(mode string) error {
+	switch mode {
+	case "", workdirNone, workdirPush, workdirSync:
+		return nil
+	default:
+		return fmt.Errorf("workdir must be one of %s, %s, or %s", workdirNone, workdirPush, workdirSync)
+	}
+}
+
+type fileStat struct {
+	size  int64
+	mtime int64
+}
+
+// ignoreFiles are files in the workdir listing paths not to be copied. Only the first one found is used.
+var ignoreFiles = []string{".cliappignore", ".gitignore"}
+
+const (
+	// Users are asked to confirm before copying more files than the limits.
+	maxWorkdirFiles = 10000
+	maxWorkdirSize  = 512 << 20
+)
+
+// checkWorkdir refuses to copy the root or the home directory, which are never meant to be workdirs.
+func checkWorkdir(dir string) error {
+	if dir == filepath.Dir(dir) {
+		return fmt.Errorf("can't copy the root directory to the app. Change to a project directory first")
+	}
+
+	if home, err := os.UserHomeDir(); err == nil && filepath.Clean(home) == dir {
+		return fmt.Errorf("can't copy the home directory to the app. Change to a project directory first")
+	}
+
+	return nil
+}
+
+// loadIgnorePatterns reads patterns in .cliappignore, or .gitignore if the former doesn't exist.
+// Patterns are in the gitignore syntax, except that character classes and escapes are the same as in .dockerignore.
+// .git directories are always ignored.
+func loadIgnorePatterns(dir string) (*fileutils.PatternMatcher, error) {
+	patterns := []string{"**/.git"}
+	for _, name := range ignoreFiles {
+		data, err := ioutil.ReadFile(filepath.Join(dir, name))
+		if os.IsNotExist(err) {
+			continue
+		}
+
+		if err != nil {
+			return nil, err
+		}
+
+		patterns = append(patterns, parseIgnorePatterns(string(data))...)
+		break
+	}
+
+	return fileutils.NewPatternMatcher(patterns)
+}
+
+// parseIgnorePatterns converts gitignore patterns to those of .dockerignore, which are always relative to the root.
+func parseIgnorePatterns(data string) (patterns []string) {
+	for _, line := range strings.Split(data, "\n") {
+		pattern := strings.TrimSpace(line)
+		if len(pattern) == 0 || strings.HasPrefix(pattern, "#") {
+			continue
+		}
+
+		exclusion := strings.HasPrefix(pattern, "!")
+		pattern = strings.TrimSuffix(strings.TrimPrefix(pattern, "!"), "/")
+		switch {
+		case len(pattern) == 0:
+			continue
+		case strings.HasPrefix(pattern, "/"):
+			pattern = strings.TrimPrefix(pattern, "/")
+		case !strings.Contains(pattern, "/"):
+			// Patterns without slashes match at any level.
+			pattern = "**/" + pattern
+		}
+
+		if exclusion {
+			pattern = "!" + pattern
+		}
+
+		patterns = append(patterns, pattern)
+	}
+
+	return patterns
+}
+
+// isIgnored tells whether the slash-separated relative path or any of its parents is ignored.
+func isIgnored(ignore *fileutils.PatternMatcher, name string) bool {
+	ignored, err := ignore.MatchesOrParentMatches(name)
+	return err == nil && ignored
+}
+
+// listLocalFiles returns regular files in the directory which are not ignored, keyed by their slash-separated
+// relative paths.
+func listLocalFiles(dir string, ignore *fileutils.PatternMatcher) (map[string]fileStat, error) {
+	files := make(map[string]fileStat)
+	err := filepath.Walk(dir, func(p string, info os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+
+		rel, err := filepath.Rel(dir, p)
+		if err != nil {
+			return err
+		}
+
+		if rel == "." {
+			return nil
+		}
+
+		rel = filepath.ToSlash(rel)
+		if info.IsDir() {
+			// Files in ignored directories can't be included again unless there are exclusions.
+			if !ignore.Exclusions() && isIgnored(ignore, rel) {
+				return filepath.SkipDir
+			}
+
+			return nil
+		}
+
+		if !info.Mode().IsRegular() || isIgnored(ignore, rel) {
+			return nil
+		}
+
+		files[rel] = fileStat{size: info.Size(), mtime: info.ModTime().Unix()}
+		return nil
+	})
+
+	return files, err
+}
+
+// removeIgnored removes remote files which are ignored, such that they are never pulled back.
+func removeIgnored(files map[string]fileStat, ignore *fileutils.PatternMatcher) {
+	for name := range files {
+		if isIgnored(ignore, name) {
+			delete(files, name)
+		}
+	}
+}
+
+// confirmPush asks users to confirm if there are too many or too large files to push.
+// The answer is read from the terminal even if stdin is piped.
+func (o *AppOptions) confirmPush(dir string, local map[string]fileStat, files []string) error {
+	var size int64
+	for _, name := range files {
+		size += local[name].size
+	}
+
+	if len(files) <= maxWorkdirFiles && size <= maxWorkdirSize {
+		return nil
+	}
+
+	prompt := fmt.Sprintf(`%d files, %s in total, in "%s" will be copied to the app. `+
+		"Add paths not required to %s to skip them", len(files), resource.NewQuantity(size, resource.BinarySI), dir,
+		ignoreFiles[0])
+
+	// Stdin is the input of the app if piped, which must not be consumed by the prompt.
+	// So, the answer is read from the controlling terminal.
+	in := o.In
+	if !utils.IsTerminal(in) {
+		tty, err := os.Open("/dev/tty")
+		if err != nil {
+			return fmt.Errorf("%s. Confirmation is required in a terminal", prompt)
+		}
+
+		defer tty.Close()
+		in = tty
+	}
+
+	confirmed, err := utils.Confirm(in, o.ErrOut, prompt+". Continue")
+	if err != nil {
+		return err
+	}
+
+	if !confirmed {
+		return fmt.Errorf("aborted")
+	}
+
+	return nil
+}
+
+// listRemoteFiles creates the directory in the app Pod if it doesn't exist, then returns regular files in it.
+func (o *AppOptions) listRemoteFiles(app *appcorev1.CliApp, dir string) (map[string]fileStat, error) {
+	const script = `mkdir -p "$1" && cd "$1" && find . -type f -exec stat -c '%s %Y %n' {} +`
+	var stdout, stderr bytes.Buffer
+	err := o.RunExec(app.Status.PodName, app.Namespace, utils.AppContainer, false, []string{"sh", "-c", script, "sh", dir},
+		kubectl.WithStdout(&stdout), kubectl.WithStderr(&stderr))
+	if err != nil {
+		return nil, fmt.Errorf(`can't list files in "%s": %s: %s`, dir, err, strings.TrimSpace(stderr.String()))
+	}
+
+	files := make(map[string]fileStat)
+	scanner := bufio.NewScanner(&stdout)
+	for scanner.Scan() {
+		fields := strings.SplitN(scanner.Text(), " ", 3)
+		if len(fields) != 3 {
+			continue
+		}
+
+		size, err := strconv.ParseInt(fields[0], 10, 64)
+		if err != nil {
+			continue
+		}
+
+		mtime, err := strconv.ParseInt(fields[1], 10, 64)
+		if err != nil {
+			continue
+		}
+
+		files[strings.TrimPrefix(fields[2], "./")] = fileStat{size: size, mtime: mtime}
+	}
+
+	return files, scanner.Err()
+}
+
+// filesToPush returns local files which don't exist in the Pod or differ from the remote ones.
+func filesToPush(local, remote map[string]fileStat) []string {
+	var files []string
+	for name, stat := range local {
+		if remoteStat, found := remote[name]; !found || remoteStat != stat {
+			files = append(files, name)
+		}
+	}
+
+	sort.Strings(files)
+	return files
+}
+
+// filesToPull returns remote files which don't exist locally or are newer than the local ones.
+func filesToPull(local, remote map[string]fileStat) []string {
+	var files []string
+	for name, stat := range remote {
+		localStat, found := local[name]
+		if !found || stat.mtime > localStat.mtime || (stat.mtime == localStat.mtime && stat.size != localStat.size) {
+			files = append(files, name)
+		}
+	}
+
+	sort.Strings(files)
+	return files
+}
+
+// pushFiles copies local files to the directory in the app Pod. Modification times are preserved.
+func (o *AppOptions) pushFiles(app *appcorev1.CliApp, localDir, remoteDir string, files []string) error {
+	r, w := io.Pipe()
+	go func() {
+		w.CloseWithError(writeTar(w, localDir, files))
+	}()
+
+	var out bytes.Buffer
+	err := o.RunExec(app.Status.PodName, app.Namespace, utils.AppContainer, false,
+		[]string{"sh", "-c", `cd "$1" && tar -xf -`, "sh", remoteDir},
+		kubectl.WithStdin(r), kubectl.WithStdout(&out), kubectl.WithStderr(&out))
+	r.Close()
+	if err != nil {
+		return fmt.Errorf(`can't push files to "%s": %s: %s`, remoteDir, err, strings.TrimSpace(out.String()))
+	}
+
+	return nil
+}
+
+func writeTar(w io.Writer, dir string, files []string) error {
+	tw := tar.NewWriter(w)
+	for _, name := range files {
+		if err := writeTarFile(tw, dir, name); err != nil {
+			return err
+		}
+	}
+
+	return tw.Close()
+}
+
+func writeTarFile(tw *tar.Writer, dir, name string) error {
+	f, err := os.Open(filepath.Join(dir, filepath.FromSlash(name)))
+	if err != nil {
+		return err
+	}
+
+	defer f.Close()
+	info, err := f.Stat()
+	if err != nil {
+		return err
+	}
+
+	hdr, err := tar.FileInfoHeader(info, "")
+	if err != nil {
+		return err
+	}
+
+	// Files are owned by the user in the Pod rather than the local one.
+	hdr.Name = name
+	hdr.Uid, hdr.Gid, hdr.Uname, hdr.Gname = 0, 0, "", ""
+	if err = tw.WriteHeader(hdr); err != nil {
+		return err
+	}
+
+	_, err = io.Copy(tw, f)
+	return err
+}
+
+// pullFiles copies files in the app Pod to the local directory. Modification times are preserved.
+func (o *AppOptions) pullFiles(app *appcorev1.CliApp, localDir, remoteDir string, files []string) error {
+	r, w := io.Pipe()
+	errCh := make(chan error, 1)
+	go func() {
+		err := readTar(r, localDir)
+		// Drain the pipe such that the remote tar doesn't block.
+		io.Copy(io.Discard, r)
+		errCh <- err
+	}()
+
+	var stderr bytes.Buffer
+	err := o.RunExec(app.Status.PodName, app.Namespace, utils.AppContainer, false,
+		[]string{"sh", "-c", `cd "$1" && tar -cf - -T -`, "sh", remoteDir},
+		kubectl.WithStdin(strings.NewReader(strings.Join(files, "\n")+"\n")),
+		kubectl.WithStdout(w), kubectl.WithStderr(&stderr))
+	w.Close()
+	if readErr := <-errCh; err == nil {
+		err = readErr
+	}
+
+	if err != nil {
+		return fmt.Errorf(`can't pull files from "%s": %s: %s`, remoteDir, err, strings.TrimSpace(stderr.String()))
+	}
+
+	return nil
+}
+
+// readTar extracts regular files in the archive to the directory.
+func readTar(r io.Reader, dir string) error {
+	tr := tar.NewReader(r)
+	for {
+		hdr, err := tr.Next()
+		if err == io.EOF {
+			return nil
+		}
+
+		if err != nil {
+			return err
+		}
+
+		if hdr.Typeflag != tar.TypeReg {
+			continue
+		}
+
+		name := path.Clean(strings.TrimPrefix(hdr.Name, "./"))
+		if path.IsAbs(name) || name == ".." || strings.HasPrefix(name, "../") {
+			return fmt.Errorf(`invalid file "%s"`, hdr.Name)
+		}
+
+		target := filepath.Join(dir, filepath.FromSlash(name))
+		if err = os.MkdirAll(filepath.Dir(target), 0755); err != nil {
+			return err
+		}
+
+		f, err := os.OpenFile(target, os.O_CREATE|os.O_TRUNC|os.O_WRONLY, os.FileMode(hdr.Mode).Perm())
+		if err != nil {
+			return err
+		}
+
+		_, err = io.Copy(f, tr)
+		f.Close()
+		if err != nil {
+			return err
+		}
+
+		if err = os.Chtimes(target, hdr.ModTime, hdr.ModTime); err != nil {
+			return err
+		}
+	}
+}
+
+// runInWorkdir pushes the current directory to the same path in the app Pod, runs the app there, then pulls changed
+// files back if the mode is sync. Files are never deleted on either side, and ignored files are copied in neither
+// direction.
+// The command runs via kubectl exec rather than the session gate since the gate can't change the working directory.
+// So, a shell is required in the app image.
+func (o *AppOptions) runInWorkdir(ctx context.Context, appClient appv1.Interface, app *appcorev1.CliApp, mode string) error {
+	localDir, err := os.Getwd()
+	if err != nil {
+		return err
+	}
+
+	if err = checkWorkdir(localDir); err != nil {
+		return err
+	}
+
+	ignore, err := loadIgnorePatterns(localDir)
+	if err != nil {
+		return err
+	}
+
+	remoteDir := path.Join(appRoot, filepath.ToSlash(localDir))
+	return o.runLive(ctx, appClient, app, func(app *appcorev1.CliApp) error {
+		local, err := listLocalFiles(localDir, ignore)
+		if err != nil {
+			return err
+		}
+
+		remote, err := o.listRemoteFiles(app, remoteDir)
+		if err != nil {
+			return err
+		}
+
+		if files := filesToPush(local, remote); len(files) > 0 {
+			if err = o.confirmPush(localDir, local, files); err != nil {
+				return err
+			}
+
+			if err = o.pushFiles(app, localDir, remoteDir, files); err != nil {
+				return err
+			}
+
+			fmt.Fprintf(o.ErrOut, "Pushed %d files to the app\n", len(files))
+		}
+
+		runErr := o.execApp(app, localDir, o.appCommand(app))
+
+		if mode == workdirSync {
+			// Results are pulled back even if the command fails.
+			if local, err = listLocalFiles(localDir, ignore); err != nil {
+				return err
+			}
+
+			if remote, err = o.listRemoteFiles(app, remoteDir); err != nil {
+				return err
+			}
+
+			removeIgnored(remote, ignore)
+
+			if files := filesToPull(local, remote); len(files) > 0 {
+				if err = o.pullFiles(app, localDir, remoteDir, files); err != nil {
+					return err
+				}
+
+				fmt.Fprintf(o.ErrOut, "Pulled %d files from the app\n", len(files))
+			}
+		}
+
+		return runErr
+	})
+}
@@ -0,0 +1,233 @@
+package app
+
+import (
+	"archive/tar"
+	"bytes"
+	"github.com/docker/docker/pkg/fileutils"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"sort"
+	"testing"
+	"time"
+)
+
+func TestReadTar(t *testing.T) {
+	type entry struct {
+		name     string
+		typeflag byte
+	}
+
+	tests := []struct {
+		name    string
+		entries []entry
+		files   []string
+		wantErr bool
+	}{
+		{
+			name:    "regular files",
+			entries: []entry{{"a.txt", tar.TypeReg}, {"./b/c.txt", tar.TypeReg}},
+			files:   []string{"a.txt", "b/c.txt"},
+		},
+		{
+			name:    "non-regular files are skipped",
+			entries: []entry{{"dir/", tar.TypeDir}, {"link", tar.TypeSymlink}, {"a.txt", tar.TypeReg}},
+			files:   []string{"a.txt"},
+		},
+		{
+			name:    "cleaned in the directory",
+			entries: []entry{{"b/../a.txt", tar.TypeReg}},
+			files:   []string{"a.txt"},
+		},
+		{
+			name:    "parent directory",
+			entries: []entry{{"../evil", tar.TypeReg}},
+			wantErr: true,
+		},
+		{
+			name:    "parent directory after cleaning",
+			entries: []entry{{"a/../../evil", tar.TypeReg}},
+			wantErr: true,
+		},
+		{
+			name:    "the parent itself",
+			entries: []entry{{"..", tar.TypeReg}},
+			wantErr: true,
+		},
+		{
+			name:    "absolute path",
+			entries: []entry{{"/etc/evil", tar.TypeReg}},
+			wantErr: true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var archive bytes.Buffer
+			tw := tar.NewWriter(&archive)
+			for _, e := range tt.entries {
+				hdr := &tar.Header{Name: e.name, Typeflag: e.typeflag, Mode: 0644, ModTime: time.Unix(1600000000, 0)}
+				if e.typeflag == tar.TypeReg {
+					hdr.Size = int64(len(e.name))
+				}
+
+				if e.typeflag == tar.TypeSymlink {
+					hdr.Linkname = "/etc/passwd"
+				}
+
+				if err := tw.WriteHeader(hdr); err != nil {
+					t.Fatal(err)
+				}
+
+				if e.typeflag == tar.TypeReg {
+					if _, err := tw.Write([]byte(e.name)); err != nil {
+						t.Fatal(err)
+					}
+				}
+			}
+
+			if err := tw.Close(); err != nil {
+				t.Fatal(err)
+			}
+
+			root := t.TempDir()
+			dir := filepath.Join(root, "workdir")
+			if err := os.Mkdir(dir, 0755); err != nil {
+				t.Fatal(err)
+			}
+
+			err := readTar(&archive, dir)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("readTar() error = %v, wantErr %v", err, tt.wantErr)
+			}
+
+			if _, err := os.Stat(filepath.Join(root, "evil")); !os.IsNotExist(err) {
+				t.Fatalf("a file is written out of the directory")
+			}
+
+			if tt.wantErr {
+				return
+			}
+
+			files, err := listLocalFiles(dir, mustLoadIgnorePatterns(t, dir))
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			if got := sortedNames(files); !reflect.DeepEqual(got, tt.files) {
+				t.Errorf("files = %v, want %v", got, tt.files)
+			}
+
+			for _, name := range tt.files {
+				if files[name].mtime != 1600000000 {
+					t.Errorf("mtime of %s = %d, want %d", name, files[name].mtime, 1600000000)
+				}
+			}
+		})
+	}
+}
+
+func TestListLocalFiles(t *testing.T) {
+	tests := []struct {
+		name   string
+		ignore map[string]string
+		files  []string
+	}{
+		{
+			name:  "no ignore files",
+			files: []string{"a/build/z", "a/node_modules/y", "build/z", "keep.log", "main.go", "x.log"},
+		},
+		{
+			name:   "gitignore",
+			ignore: map[string]string{".gitignore": "# comment\n\nnode_modules/\n/build\n*.log\n!keep.log\n"},
+			files:  []string{".gitignore", "a/build/z", "keep.log", "main.go"},
+		},
+		{
+			name: "cliappignore takes precedence",
+			ignore: map[string]string{
+				".gitignore":    "*.log\n",
+				".cliappignore": "build\n",
+			},
+			files: []string{".cliappignore", ".gitignore", "a/node_modules/y", "keep.log", "main.go", "x.log"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			dir := t.TempDir()
+			files := []string{".git/config", "a/.git/HEAD", "a/build/z", "a/node_modules/y", "build/z", "keep.log",
+				"main.go", "x.log"}
+			for name, content := range tt.ignore {
+				files = append(files, name)
+				writeFile(t, filepath.Join(dir, name), content)
+			}
+
+			for _, name := range files {
+				if _, found := tt.ignore[name]; !found {
+					writeFile(t, filepath.Join(dir, filepath.FromSlash(name)), name)
+				}
+			}
+
+			got, err := listLocalFiles(dir, mustLoadIgnorePatterns(t, dir))
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			if names := sortedNames(got); !reflect.DeepEqual(names, tt.files) {
+				t.Errorf("files = %v, want %v", names, tt.files)
+			}
+		})
+	}
+}
+
+func TestCheckWorkdir(t *testing.T) {
+	home, err := os.UserHomeDir()
+	if err != nil {
+		t.Skip(err)
+	}
+
+	tests := []struct {
+		dir     string
+		wantErr bool
+	}{
+		{dir: "/", wantErr: true},
+		{dir: filepath.Clean(home), wantErr: true},
+		{dir: filepath.Join(home, "project")},
+	}
+
+	for _, tt := range tests {
+		if err := checkWorkdir(tt.dir); (err != nil) != tt.wantErr {
+			t.Errorf("checkWorkdir(%s) error = %v, wantErr %v", tt.dir, err, tt.wantErr)
+		}
+	}
+}
+
+func mustLoadIgnorePatterns(t *testing.T, dir string) *fileutils.PatternMatcher {
+	ignore, err := loadIgnorePatterns(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return ignore
+}
+
+func writeFile(t *testing.T, path, content string) {
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := ioutil.WriteFile(path, []byte(content), 0644); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func sortedNames(files map[string]fileStat) []string {
+	names := make([]string, 0, len(files))
+	for name := range files {
+		names = append(names, name)
+	}
+
+	sort.Strings(names)
+	return names
+}
@@ -33,7 +33,6 @@ import (
 	"github.com/pkg/errors"
 	"github.com/spf13/cobra"
 	"github.com/warm-metal/kubectl-dev/pkg/cmd/opts"
-	"github.com/warm-metal/kubectl-dev/pkg/kubectl"
 	"github.com/warm-metal/kubectl-dev/pkg/utils"
 	"io/ioutil"
 	"k8s.io/cli-runtime/pkg/genericclioptions"
@@ -252,7 +251,7 @@ func (o *BuildOptions) Validate() error {
 	return nil
 }
 
-func solve(
+func (o *BuildOptions) solve(
 	ctx context.Context, client *buildkit.Client, pw progresswriter.Writer,
 	solveOpt *buildkit.SolveOpt, config *BuildContext,
 ) error {
@@ -289,7 +288,7 @@ func solve(
 				manifest = imagePattern.ReplaceAll(manifest, []byte(fmt.Sprintf("image: %s", image)))
 			}
 
-			err = kubectl.ApplyManifestsFromStdin(strings.NewReader(string(manifest)))
+			err = o.ApplyManifestsFromStdin(strings.NewReader(string(manifest)))
 			if err != nil {
 				fmt.Fprintf(os.Stderr, "Error applying manifests: %s\n", err)
 			}
@@ -334,13 +333,13 @@ func (o *BuildOptions) Run(ctx context.Context) (err error) {
 	if o.config != nil {
 		for key := range o.config {
 			config := o.config[key]
-			if err = solve(ctx, client, pw, config.solveOpt, &config); err != nil {
+			if err = o.solve(ctx, client, pw, config.solveOpt, &config); err != nil {
 				return err
 			}
 			o.config[key] = config
 		}
 	} else {
-		if err = solve(ctx, client, pw, o.solveOpt, &o.BuildContext); err != nil {
+		if err = o.solve(ctx, client, pw, o.solveOpt, &o.BuildContext); err != nil {
 			return err
 		}
 	}
@@ -0,0 +1,71 @@
+package cmd
+
+import (
+	"fmt"
+	"github.com/spf13/cobra"
+	"github.com/warm-metal/kubectl-dev/pkg/utils"
+	"io/ioutil"
+	"k8s.io/cli-runtime/pkg/genericclioptions"
+	"os"
+	"path/filepath"
+)
+
+// kubectlPluginCompletion is the helper through which kubectl 1.26+ completes "kubectl dev".
+const kubectlPluginCompletion = `#!/bin/sh
+# Generated by kubectl-dev. Completes "kubectl dev" for kubectl.
+exec kubectl-dev __complete "$@"
+`
+
+func NewCmdCompletion(streams genericclioptions.IOStreams) *cobra.Command {
+	var binDir string
+	var cmd = &cobra.Command{
+		Use:   "completion bash|zsh|fish|powershell|kubectl",
+		Short: "Generate the shell completion script of kubectl-dev.",
+		Long: `Generate the shell completion script of kubectl-dev for the specified shell.
+The script completes the command "kubectl-dev". To complete "kubectl dev" instead, run "kubectl dev completion kubectl"
+to install the helper "kubectl_complete-dev" for kubectl, which requires kubectl 1.26 or later.
+Completion scripts of CliApps are generated via "kubectl dev app completion".`,
+		Example: `# Load completions in the current bash session
+source <(kubectl dev completion bash)
+
+# Load completions of zsh for each session
+kubectl dev completion zsh > "${fpath[1]}/_kubectl-dev"
+
+# Complete "kubectl dev" through kubectl
+kubectl dev completion kubectl
+`,
+		ValidArgs:    []string{"bash", "zsh", "fish", "powershell", "kubectl"},
+		Args:         cobra.ExactValidArgs(1),
+		SilenceUsage: true,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			root := cmd.Root()
+			switch args[0] {
+			case "bash":
+				return root.GenBashCompletionV2(streams.Out, true)
+			case "zsh":
+				return root.GenZshCompletion(streams.Out)
+			case "fish":
+				return root.GenFishCompletion(streams.Out, true)
+			case "powershell":
+				return root.GenPowerShellCompletionWithDesc(streams.Out)
+			}
+
+			dir := utils.ExpandTilde(binDir)
+			if err := os.MkdirAll(dir, 0755); err != nil {
+				return err
+			}
+
+			path := filepath.Join(dir, "kubectl_complete-dev")
+			if err := ioutil.WriteFile(path, []byte(kubectlPluginCompletion), 0755); err != nil {
+				return err
+			}
+
+			fmt.Fprintf(streams.Out, "Installed %s. It should be one of the PATH.\n", path)
+			return nil
+		},
+	}
+
+	cmd.Flags().StringVar(&binDir, "install-base", utils.UserBinDir(),
+		`Directory where the helper "kubectl_complete-dev" to be installed. It should be one of the PATH.`)
+	return cmd
+}
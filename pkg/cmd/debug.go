@@ -19,11 +19,15 @@ import (
 	"context"
 	"crypto/md5"
 	"fmt"
+	"github.com/moby/term"
 	"github.com/spf13/cobra"
 	appcorev1 "github.com/warm-metal/cliapp/pkg/apis/cliapp/v1"
 	appv1 "github.com/warm-metal/cliapp/pkg/clientset/versioned"
 	"github.com/warm-metal/cliapp/pkg/libcli"
 	"github.com/warm-metal/kubectl-dev/pkg/cmd/opts"
+	"github.com/warm-metal/kubectl-dev/pkg/diagnose"
+	"github.com/warm-metal/kubectl-dev/pkg/image"
+	"github.com/warm-metal/kubectl-dev/pkg/session"
 	"github.com/warm-metal/kubectl-dev/pkg/utils"
 	"k8s.io/apimachinery/pkg/api/errors"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
@@ -39,6 +43,28 @@ type DebugOptions struct {
 	useHTTPProxy bool
 	alsoForkEnvs bool
 
+	runOriginal bool
+	command     []string
+	args        []string
+
+	toolkit     string
+	capture     string
+	record      string
+	recordInput bool
+
+	persistent   bool
+	detachKeys   string
+	detachKeySeq []byte
+
+	packageManager string
+	shellPath      string
+	contextImage   string
+
+	overrideConfigMaps []string
+	overrideSecrets    []string
+	volumes            []string
+	emptyDirs          []string
+
 	instance  string
 	image     string
 	namespace string
@@ -47,6 +73,22 @@ type DebugOptions struct {
 	distro      string
 	shell       string
 
+	selector string
+	podIndex int
+	sameNode bool
+	node     string
+
+	workload *utils.Workload
+
+	initContainer bool
+	allContainers bool
+	withVolumes   string
+
+	diagnoseOnly bool
+
+	execArgs []string
+	script   string
+
 	app *appcorev1.CliApp
 }
 
@@ -55,15 +97,27 @@ func NewDebugOptions(opts *opts.GlobalOptions, streams genericclioptions.IOStrea
 		GlobalOptions: opts,
 		IOStreams:     streams,
 		namespace:     metav1.NamespaceDefault,
+		podIndex:      -1,
+		sameNode:      true,
+		detachKeys:    "ctrl-p,ctrl-q",
 	}
 }
 
-func (o *DebugOptions) Complete(_ *cobra.Command, args []string) error {
+func (o *DebugOptions) Complete(cmd *cobra.Command, args []string) error {
 	if o.Raw().Namespace != nil && len(*o.Raw().Namespace) > 0 {
 		o.namespace = *o.Raw().Namespace
 	}
 
-	if len(args) == 0 {
+	if dash := cmd.ArgsLenAtDash(); dash >= 0 {
+		o.execArgs = args[dash:]
+		args = args[:dash]
+	}
+
+	if len(args) > 0 && len(o.selector) > 0 {
+		return fmt.Errorf("an object and a label selector can't be specified at the same time")
+	}
+
+	if len(args) == 0 && len(o.selector) == 0 {
 		if len(o.image) == 0 {
 			return fmt.Errorf("specify an image or an object")
 		}
@@ -72,6 +126,15 @@ func (o *DebugOptions) Complete(_ *cobra.Command, args []string) error {
 		o.instance = fmt.Sprintf("debugger-%s", imageKey)
 	} else {
 		o.kindAndName = strings.Join(args, "/")
+		if len(o.selector) > 0 || o.podIndex >= 0 || len(o.withVolumes) > 0 {
+			pod, err := o.selectPod(cmd.Context())
+			if err != nil {
+				return err
+			}
+
+			o.kindAndName = "pod/" + pod.Name
+		}
+
 		o.instance = fmt.Sprintf("debugger-%s", strings.Replace(o.kindAndName, "/", "-", -1))
 	}
 
@@ -107,22 +170,63 @@ func (o *DebugOptions) Complete(_ *cobra.Command, args []string) error {
 		o.app.Spec.Env = append(o.app.Spec.Env, proxies...)
 	}
 
-	if len(o.distro) > 0 {
-		distro, err := utils.ValidateDistro(o.distro)
+	for _, volume := range o.volumes {
+		hostPath, mountPoint, err := parseVolume(volume)
 		if err != nil {
 			return err
 		}
 
-		o.app.Spec.Distro = distro
+		if len(hostPath) > 0 {
+			o.app.Spec.HostPath = append(o.app.Spec.HostPath, hostPath+":"+mountPoint)
+		} else {
+			o.emptyDirs = append(o.emptyDirs, mountPoint)
+		}
 	}
 
-	if len(o.shell) > 0 {
-		shell, err := utils.ValidateShell(o.shell)
+	if len(o.detachKeys) > 0 {
+		keys, err := term.ToBytes(o.detachKeys)
 		if err != nil {
-			return err
+			return fmt.Errorf("invalid detach keys: %s", err)
 		}
 
-		o.app.Spec.Shell = shell
+		o.detachKeySeq = keys
+	}
+
+	if len(o.distro) == 0 {
+		o.distro = string(appcorev1.CliAppDistroAlpine)
+	}
+
+	distro, err := utils.LookupDistro(o.distro)
+	if err != nil {
+		return err
+	}
+
+	o.app.Spec.Distro = distro.Base
+	o.packageManager = distro.PackageManager
+	if len(o.contextImage) == 0 {
+		o.contextImage = distro.ContextImage
+	}
+
+	shell := o.shell
+	if len(shell) == 0 {
+		shell = string(appcorev1.CliAppShellBash)
+		if _, err := distro.LookupShell(shell); err != nil && len(o.contextImage) > 0 {
+			shell = "sh"
+		}
+	}
+
+	if o.shellPath, err = distro.LookupShell(shell); err != nil {
+		if len(o.contextImage) == 0 {
+			return fmt.Errorf("%s. Other shells require a context image providing them via --context-image", err)
+		}
+
+		// Shells not declared by the distro are looked up in the PATH of the context image.
+		o.shellPath = strings.ToLower(shell)
+	}
+
+	// Shells other than bash or zsh are started by the default one.
+	if appShell, err := utils.ValidateShell(shell); err == nil {
+		o.app.Spec.Shell = appShell
 	}
 
 	return nil
@@ -133,9 +237,164 @@ func (o *DebugOptions) Validate() error {
 		return fmt.Errorf("an image or object is required. See the usage")
 	}
 
+	if err := validateToolkit(o.toolkit); err != nil {
+		return err
+	}
+
+	if err := validateVolumesMode(o.withVolumes); err != nil {
+		return err
+	}
+
+	if len(o.kindAndName) == 0 && (o.allContainers || len(o.withVolumes) > 0) {
+		return fmt.Errorf("--all-containers and --with-volumes are only valid if debugging an object")
+	}
+
+	if len(o.kindAndName) == 0 && (len(o.overrideConfigMaps) > 0 || len(o.overrideSecrets) > 0) {
+		return fmt.Errorf("ConfigMaps or Secrets can be overridden only if debugging an object")
+	}
+
+	if o.nonInteractive() && (len(o.record) > 0 || o.persistent) {
+		return fmt.Errorf("--record and --persistent are only supported in interactive sessions")
+	}
+
+	if o.recordInput && len(o.record) == 0 {
+		return fmt.Errorf("--record-input requires --record")
+	}
+
 	return nil
 }
 
+// originalEntrypointLog is the file in the debugger to which the output of the original entrypoint is redirected.
+const originalEntrypointLog = "/tmp/app-root.log"
+
+// entrypoint returns the command line and the working directory to start the target container.
+// Overrides in --command and --args are applied as the same as in a Pod spec. If the command is set in neither,
+// the ENTRYPOINT of the image is used, along with its CMD if no args are set either.
+func (o *DebugOptions) entrypoint(ctx context.Context) (cmdline []string, workdir string, err error) {
+	command, args, ref := o.command, o.args, o.image
+	if len(o.kindAndName) > 0 {
+		container, _, err := utils.FindContainerOrInitContainer(&o.workload.Template.Spec, o.container)
+		if err != nil {
+			return nil, "", err
+		}
+
+		if len(command) == 0 {
+			command = container.Command
+		}
+
+		if len(args) == 0 {
+			args = container.Args
+		}
+
+		if len(ref) == 0 {
+			ref = container.Image
+		}
+
+		workdir = container.WorkingDir
+	}
+
+	if len(command) == 0 {
+		img, err := o.fetchImage(ctx, ref)
+		if err != nil {
+			return nil, "", fmt.Errorf("unable to read the entrypoint of image %s: %s. Specify it via --command",
+				ref, err)
+		}
+
+		command = img.Config.Config.Entrypoint
+		if len(args) == 0 {
+			args = img.Config.Config.Cmd
+		}
+
+		if len(workdir) == 0 {
+			workdir = img.Config.Config.WorkingDir
+		}
+	}
+
+	// Copy the command, such that neither options nor the Pod spec are changed by appending args.
+	cmdline = append(append([]string(nil), command...), args...)
+	if len(cmdline) == 0 {
+		return nil, "", fmt.Errorf("the entrypoint of %s is empty. Specify it via --command", ref)
+	}
+
+	return cmdline, workdir, nil
+}
+
+// fetchImage reads the image in the cluster, or fetches it from its registry for the platform of the cluster if the
+// image is not found there.
+func (o *DebugOptions) fetchImage(ctx context.Context, ref string) (*image.Image, error) {
+	cluster, err := image.NewClusterResolver(ctx, o.ConfigFlags)
+	if err == nil {
+		defer cluster.Close()
+		img, err := image.Fetch(ctx, cluster, ref, cluster.Platform)
+		if err == nil {
+			return img, nil
+		}
+
+		fmt.Fprintf(o.ErrOut, "Warning: %s. Fetching it from its registry\n", err)
+		return image.Fetch(ctx, image.NewResolver(o.ErrOut), ref, cluster.Platform)
+	}
+
+	platform, err := image.ClusterPlatform(ctx, o.ConfigFlags)
+	if err != nil {
+		return nil, err
+	}
+
+	return image.Fetch(ctx, image.NewResolver(o.ErrOut), ref, platform)
+}
+
+// sessionCommand returns the command the debugger session executes.
+// It is the shell, or the command or script to run non-interactively. If required, toolkits are installed and the original entrypoint is started in background before the shell.
+// The runner is the shell of the debugger which must be bash or zsh.
+func (o *DebugOptions) sessionCommand(ctx context.Context, runner string) ([]string, error) {
+	target, err := o.sessionTarget()
+	if err != nil {
+		return nil, err
+	}
+
+	var setup []string
+	if len(o.toolkit) > 0 {
+		install, err := installScript(o.packageManager, toolkitTools(o.toolkit)...)
+		if err != nil {
+			return nil, err
+		}
+
+		setup = append(setup, install)
+	}
+
+	if o.runOriginal || len(o.command) > 0 || len(o.args) > 0 {
+		cmdline, workdir, err := o.entrypoint(ctx)
+		if err != nil {
+			return nil, err
+		}
+
+		start := "chroot /app-root " + utils.ShellQuote(cmdline...)
+		if len(workdir) > 0 {
+			start = fmt.Sprintf(`if [ -x /app-root/bin/sh ]; then chroot /app-root /bin/sh -c 'cd "$0" && exec "$@"' %s; else %s; fi`,
+				utils.ShellQuote(append([]string{workdir}, cmdline...)...), start)
+		}
+
+		fmt.Fprintf(o.ErrOut, "Starting %s in background. Its output is redirected to %s in the debugger.\n",
+			utils.ShellQuote(cmdline...), originalEntrypointLog)
+		setup = append(setup, fmt.Sprintf("(%s) >%s 2>&1 &", start, originalEntrypointLog))
+	}
+
+	if len(o.contextImage) > 0 {
+		enter := append([]string{"chroot", debugContextRoot}, target...)
+		if len(setup) > 0 {
+			enter = []string{"chroot", debugContextRoot, o.shellPath, "-c",
+				strings.Join(append(setup, "exec "+utils.ShellQuote(target...)), "\n")}
+		}
+
+		return []string{runner, "-c", debugContextMountScript + "\nexec " + utils.ShellQuote(enter...)}, nil
+	}
+
+	if len(setup) == 0 {
+		return target, nil
+	}
+
+	return []string{runner, "-c", strings.Join(append(setup, "exec "+utils.ShellQuote(target...)), "\n")}, nil
+}
+
 func (o *DebugOptions) Run(ctx context.Context, cmd *cobra.Command) error {
 	conf, err := o.Raw().ToRESTConfig()
 	if err != nil {
@@ -147,6 +406,67 @@ func (o *DebugOptions) Run(ctx context.Context, cmd *cobra.Command) error {
 		return err
 	}
 
+	clientset, err := o.ClientSet()
+	if err != nil {
+		return err
+	}
+
+	if len(o.kindAndName) > 0 {
+		if o.workload, err = utils.FetchWorkload(o.Raw(), o.namespace, o.kindAndName); err != nil {
+			return err
+		}
+	}
+
+	if o.diagnoseOnly {
+		return o.diagnose(ctx, clientset)
+	}
+
+	if o.workload != nil {
+		if err = o.chooseContainer(); err != nil {
+			return err
+		}
+
+		if o.app.Spec.Fork != nil {
+			o.app.Spec.Fork.Container = o.container
+		}
+	}
+
+	if o.workload != nil && o.workload.Pod != nil {
+		// The diagnosis never stops the session. Anything the user can't read is reported as unavailable.
+		diagnose.Pod(ctx, clientset, o.workload.Pod, o.Out)
+		if o.sameNode {
+			o.node = o.workload.Pod.Spec.NodeName
+		}
+	}
+
+	if o.sameNode && len(o.node) == 0 && cmd.Flags().Changed("same-node") {
+		return fmt.Errorf("--same-node requires a scheduled Pod. Specify a Pod, a label selector, or --pod-index")
+	}
+
+	if len(o.withVolumes) > 0 {
+		if err = o.prepareVolumes(ctx, clientset); err != nil {
+			return err
+		}
+	}
+
+	var tmpl *forkTemplate
+	if o.needForkTemplate() {
+		if tmpl, err = o.buildForkTemplate(); err != nil {
+			return err
+		}
+
+		if len(o.node) > 0 {
+			o.checkNode(ctx, clientset, &tmpl.rs.Spec.Template.Spec)
+		}
+
+		if err = tmpl.apply(ctx, clientset); err != nil {
+			return err
+		}
+
+		o.app.Spec.Image = ""
+		o.app.Spec.Fork = tmpl.forkObject(o.alsoForkEnvs)
+	}
+
 	app, err := appClient.CliappV1().CliApps(o.app.Namespace).Get(ctx, o.app.Name, metav1.GetOptions{})
 	if err != nil && !errors.IsNotFound(err) {
 		return err
@@ -165,19 +485,71 @@ func (o *DebugOptions) Run(ctx context.Context, cmd *cobra.Command) error {
 		}
 	}
 
-	clientset, err := o.ClientSet()
+	if tmpl != nil {
+		if err = tmpl.adopt(ctx, clientset, app); err != nil {
+			return err
+		}
+	}
+
+	if len(o.capture) > 0 {
+		if app, err = utils.WaitForAppPod(ctx, appClient, app, o.ErrOut); err != nil {
+			return err
+		}
+
+		stop, err := o.startCapture(app)
+		if err != nil {
+			return err
+		}
+
+		defer stop()
+	}
+
+	if o.nonInteractive() {
+		cmd.SilenceUsage = true
+		cmd.SilenceErrors = true
+		return o.execInDebugger(ctx, appClient, app)
+	}
+
+	endpoints, err := libcli.FetchGateEndpoints(ctx, clientset)
 	if err != nil {
 		return err
 	}
 
-	endpoints, err := libcli.FetchGateEndpoints(ctx, clientset)
+	sessionCmd, err := o.sessionCommand(ctx, string(app.Spec.Shell))
 	if err != nil {
 		return err
 	}
 
+	sessionOpts := []session.Option{session.WithDetachKeys(o.detachKeySeq)}
+	if o.persistent {
+		if sessionCmd, err = persistentCommand(app, sessionCmd); err != nil {
+			return err
+		}
+
+		sessionOpts = append(sessionOpts, session.WithReconnect())
+	}
+
+	recorder, err := newRecorder(o.record, app.Name, o.recordInput)
+	if err != nil {
+		return err
+	}
+
+	defer recorder.Close()
+
 	cmd.SilenceUsage = true
 	cmd.SilenceErrors = true
-	err = libcli.ExecCliApp(ctx, endpoints, app, []string{string(app.Spec.Shell)}, o.In, o.Out)
+	sessionOpts = append(sessionOpts, session.WithRecorder(recorder))
+	err = session.Exec(ctx, endpoints, app, sessionCmd, o.In, o.Out, sessionOpts...)
+	if err == session.ErrDetached {
+		if o.persistent {
+			fmt.Fprintf(o.ErrOut, "\nDetached from the debugger. Run the same command to attach again.\n")
+		} else {
+			fmt.Fprintf(o.ErrOut, "\nDetached from the debugger. The shell is closed.\n")
+		}
+
+		return nil
+	}
+
 	if err != nil {
 		return fmt.Errorf("unable to open app shell: %s", err)
 	}
@@ -204,9 +576,18 @@ kubectl dev debug deploy foo
 # The debugger Pod would not fork environment variables from the original workload.
 kubectl dev debug deploy foo --with-original-envs
 
-# Specify container name if more than one containers in the Pod.
+# Specify container name if more than one containers in the Pod. Choose one interactively if omitted.
 kubectl dev debug ds foo -c bar
 
+# Debug an init container. Init containers after it and regular containers are not started in the debugger.
+kubectl dev debug pod foo -c init-db
+
+# Attach volumes of the second replica of a StatefulSet read-only. Use "--with-volumes=rw" to make them writable.
+kubectl dev debug sts foo --pod-index 1 --with-volumes
+
+# Also mount images of all other containers at /app-root/<container>.
+kubectl dev debug pod foo -c bar --all-containers
+
 # Debug a Pod with a new versioned image. 
 kubectl dev debug pod foo --image bar:new-version
 
@@ -215,6 +596,54 @@ kubectl dev debug --image foo:latest
 
 # Pass the local HTTP_PROXY to the debugger Pod.
 kubectl dev debug cronjob foo --use-proxy
+
+# Debug one of Pods matching the label selector. Choose one interactively if more than one matched.
+kubectl dev debug -l app=foo
+
+# Debug the second replica of a Deployment, using the actual spec of the Pod on its node.
+kubectl dev debug deploy foo --pod-index 1
+
+# Debug a replica on another node than the one it is running on.
+kubectl dev debug deploy foo --pod-index 0 --same-node=false
+
+# Install network tools in the debugger and capture packets of the forked Pod to a local file.
+kubectl dev debug deploy foo --toolkit net --capture foo.pcap
+
+# Debug in a custom context image with the fish shell.
+kubectl dev debug deploy foo --context-image foo/debug-tools:latest --shell fish
+
+# Record the session to an asciicast file. Replay it via "kubectl dev replay foo.cast".
+kubectl dev debug deploy foo --record foo.cast
+
+# Explain why Pods of a Deployment are pending or unable to pull images without starting a debugger.
+kubectl dev debug deploy foo --diagnose
+
+# Open a shell which survives network failures. Detach via ctrl-p,ctrl-q and attach again via the same command.
+kubectl dev debug deploy foo --persistent
+
+# Run a command in the debugger non-interactively and exit with its exit code.
+kubectl dev debug deploy foo -- ls -l /app-root/etc
+
+# Run a local script in the debugger with arguments.
+kubectl dev debug deploy foo --script ./check-health.sh -- --verbose
+
+# Debug a crash-looping Pod. The last termination state and previous logs are printed before the session opens.
+kubectl dev debug pod/foo
+
+# Run the original entrypoint in background then open a shell to watch it.
+kubectl dev debug deploy foo --run-original
+
+# Start the workload with modified arguments.
+kubectl dev debug deploy foo --args=--log-level=debug --args=--config=/etc/foo/foo.yaml
+
+# Start the workload with another command.
+kubectl dev debug deploy foo --command /bin/foo-debug
+
+# Mount local content instead of the original ConfigMap and Secret.
+kubectl dev debug deploy foo --override-configmap foo-conf=./conf --override-secret foo-tls=./tls.crt
+
+# Mount a host path and an emptyDir volume to the debugger.
+kubectl dev debug deploy foo --volume /var/log:/host-log --volume emptyDir:/scratch
 `,
 		RunE: func(cmd *cobra.Command, args []string) error {
 			if err := o.Complete(cmd, args); err != nil {
@@ -233,18 +662,76 @@ kubectl dev debug cronjob foo --use-proxy
 
 	cmd.Flags().StringVarP(
 		&o.container, "container", "c", o.container,
-		"Container of the specified object if in which there are multiple containers")
+		"Container of the specified object if in which there are multiple containers. Init containers are also supported.")
+	cmd.Flags().BoolVar(&o.allContainers, "all-containers", false,
+		"Also mount images of all other containers, including init containers, at /app-root/<container>.")
+	cmd.Flags().StringVar(&o.withVolumes, "with-volumes", "",
+		"Attach PersistentVolumeClaims of the target replica to the debugger, read-only(ro) or read-write(rw). "+
+			"Read-write requires confirmation. The replica is chosen as the same as --pod-index if not specified. "+
+			"If not set, they are replaced with empty directories.")
+	cmd.Flags().Lookup("with-volumes").NoOptDefVal = volumesReadOnly
 	cmd.Flags().StringVar(&o.image, "image", "",
 		"The target image. If not set, use the image which the object used.")
 	cmd.Flags().BoolVar(&o.useHTTPProxy, "use-proxy", false,
 		"If set, use current HTTP proxy settings.")
 	cmd.Flags().StringVar(&o.distro, "distro", "",
-		"Linux distro that the app prefer. The default value is alpine. ubuntu is also supported.")
+		"Linux distro that the app prefer. The default value is alpine. ubuntu and distros defined in "+
+			"~/.kubectl-dev/distro are also supported.")
 	cmd.Flags().StringVar(&o.shell, "shell", "",
-		"The shell you prefer. The default value is bash. You can also use zsh instead.")
+		"The shell you prefer. The default value is bash. zsh and shells defined by the distro are also supported. "+
+			"Other shells are supported along with --context-image if the image provides them.")
+	cmd.Flags().StringVar(&o.contextImage, "context-image", "",
+		"The image in which debug sessions run instead of the default one of the distro.")
 	cmd.Flags().BoolVar(&o.alsoForkEnvs, "with-original-envs", true,
 		"Copy original labels if enabled. Such that network traffic could also gets into the debug Pod.")
+	cmd.Flags().StringVarP(&o.selector, "selector", "l", "",
+		"Label selector to choose a Pod to debug.")
+	cmd.Flags().IntVar(&o.podIndex, "pod-index", o.podIndex,
+		"Index of the Pod, sorted by name, among Pods matching the selector or created by the object. "+
+			"If not set, choose one interactively.")
+	cmd.Flags().BoolVar(&o.sameNode, "same-node", o.sameNode,
+		"Schedule the debugger on the same node as the target Pod. Enabled by default if the target is a Pod.")
+	cmd.Flags().BoolVar(&o.diagnoseOnly, "diagnose", false,
+		"Explain why the target Pods are pending, crash-looping or unable to pull images without starting a debugger. "+
+			"Image pull failures are checked against credentials saved by \"kubectl dev login\".")
+	cmd.Flags().StringVar(&o.script, "script", "",
+		"Run the local script via the shell in the debugger non-interactively. "+
+			"Arguments after \"--\" are passed to the script.")
+	cmd.Flags().BoolVar(&o.persistent, "persistent", false,
+		"Run the shell in a tmux session in the debugger. The session survives disconnections and is attached again "+
+			"automatically once the network recovers, or by running the same command after detached.")
+	cmd.Flags().StringVar(&o.detachKeys, "detach-keys", o.detachKeys,
+		`Key sequence to detach from the session, in the format of "ctrl-<value>" or a single character.`)
+	cmd.Flags().StringVar(&o.toolkit, "toolkit", "",
+		"Install a toolkit in the debugger. net(tcpdump, curl, dig, ss), perf(perf, strace, ltrace), or all.")
+	cmd.Flags().StringVar(&o.capture, "capture", "",
+		"Capture packets in the debugger Pod via tcpdump and save them to the local pcap file.")
+	cmd.Flags().StringVar(&o.record, "record", "",
+		"Record the session to the local file in the asciicast v2 format.")
+	cmd.Flags().BoolVar(&o.recordInput, "record-input", false,
+		"Also record keys typed in the session, including passwords which are not echoed.")
+	cmd.Flags().BoolVar(&o.runOriginal, "run-original", false,
+		"If set, run the original entrypoint of the target container in background in the debugger.")
+	cmd.Flags().StringArrayVar(&o.command, "command", nil,
+		"Override the command of the target container and run it in background. Can be repeated for each part.")
+	cmd.Flags().StringArrayVar(&o.args, "args", nil,
+		"Override the arguments of the target container and run it in background. Can be repeated for each argument.")
+	cmd.Flags().StringArrayVar(&o.overrideConfigMaps, "override-configmap", nil,
+		`Mount a local directory or file instead of the ConfigMap in the form of "name=local-path".`)
+	cmd.Flags().StringArrayVar(&o.overrideSecrets, "override-secret", nil,
+		`Mount a local directory or file instead of the Secret in the form of "name=local-path".`)
+	cmd.Flags().StringArrayVar(&o.volumes, "volume", nil,
+		`Additional volume in the form of "hostpath:mount-point" or "emptyDir:mount-point".`)
 	o.AddPersistentFlags(cmd.Flags())
 
 	return cmd
 }
+
+// newRecorder creates a session recorder if a file is given.
+func newRecorder(file, title string, recordInput bool) (*session.Recorder, error) {
+	if len(file) == 0 {
+		return nil, nil
+	}
+
+	return session.NewRecorder(utils.ExpandTilde(file), title, recordInput)
+}
@@ -0,0 +1,46 @@
+package cmd
+
+import (
+	"context"
+	"fmt"
+	"github.com/warm-metal/kubectl-dev/pkg/diagnose"
+	"github.com/warm-metal/kubectl-dev/pkg/utils"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/client-go/kubernetes"
+)
+
+// diagnose prints diagnoses of the target image, or of all Pods of the target object, without starting a debugger.
+func (o *DebugOptions) diagnose(ctx context.Context, clientset *kubernetes.Clientset) error {
+	if o.workload == nil {
+		fmt.Fprintf(o.Out, "Image %s:\n", o.image)
+		diagnose.ImagePull(ctx, o.image, o.Out)
+		return nil
+	}
+
+	pods, err := o.workload.ListPods(ctx, clientset)
+	if err != nil {
+		return err
+	}
+
+	if len(pods) == 0 {
+		fmt.Fprintf(o.Out, "No Pod of %s found. Check events of the object and its controller.\n", o.kindAndName)
+		return nil
+	}
+
+	healthy := 0
+	for i := range pods {
+		pod := &pods[i]
+		if pod.Status.Phase != corev1.PodPending && len(utils.GetAbnormalContainerStatuses(pod.Status)) == 0 {
+			healthy++
+			continue
+		}
+
+		diagnose.Pod(ctx, clientset, pod, o.Out)
+	}
+
+	if healthy > 0 {
+		fmt.Fprintf(o.Out, "%d of %d Pods of %s are healthy\n", healthy, len(pods), o.kindAndName)
+	}
+
+	return nil
+}
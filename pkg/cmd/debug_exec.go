@@ -0,0 +1,55 @@
+package cmd
+
+import (
+	"context"
+	"fmt"
+	appcorev1 "github.com/warm-metal/cliapp/pkg/apis/cliapp/v1"
+	appv1 "github.com/warm-metal/cliapp/pkg/clientset/versioned"
+	"github.com/warm-metal/kubectl-dev/pkg/kubectl"
+	"github.com/warm-metal/kubectl-dev/pkg/utils"
+	"io/ioutil"
+	"path/filepath"
+)
+
+// nonInteractive returns true if a command or a script is going to run instead of the shell.
+func (o *DebugOptions) nonInteractive() bool {
+	return len(o.execArgs) > 0 || len(o.script) > 0
+}
+
+// sessionTarget returns the command finally executed in the debugger, which is the shell, the script or the command
+// following "--".
+func (o *DebugOptions) sessionTarget() ([]string, error) {
+	if len(o.script) > 0 {
+		script, err := ioutil.ReadFile(utils.ExpandTilde(o.script))
+		if err != nil {
+			return nil, fmt.Errorf("unable to read script: %s", err)
+		}
+
+		// The script name is passed as $0.
+		return append([]string{o.shellPath, "-c", string(script), filepath.Base(o.script)}, o.execArgs...), nil
+	}
+
+	if len(o.execArgs) > 0 {
+		return o.execArgs, nil
+	}
+
+	return []string{o.shellPath}, nil
+}
+
+// execInDebugger runs the command or script in the debugger once it is live, and returns an exec.CodeExitError if
+// the command fails. Stdin is always attached, and a TTY is allocated only if both stdin and stdout are terminals.
+func (o *DebugOptions) execInDebugger(ctx context.Context, appClient *appv1.Clientset, app *appcorev1.CliApp) error {
+	app, err := utils.WaitForAppPod(ctx, appClient, app, o.ErrOut)
+	if err != nil {
+		return err
+	}
+
+	args, err := o.sessionCommand(ctx, string(app.Spec.Shell))
+	if err != nil {
+		return err
+	}
+
+	tty := utils.IsTerminal(o.In) && utils.IsTerminal(o.Out)
+	return o.RunExec(app.Status.PodName, app.Namespace, utils.AppContainer, tty, args,
+		kubectl.WithStdin(o.In), kubectl.WithStdout(o.Out), kubectl.WithStderr(o.ErrOut))
+}
@@ -0,0 +1,31 @@
+package cmd
+
+import (
+	"fmt"
+	appcorev1 "github.com/warm-metal/cliapp/pkg/apis/cliapp/v1"
+	"github.com/warm-metal/kubectl-dev/pkg/utils"
+)
+
+// persistentSession is the tmux session in the debugger which survives disconnections.
+const persistentSession = "kubectl-dev"
+
+// persistentCommand wraps the session command by a tmux session. A new session is created if not exists. Otherwise,
+// it is attached. tmux is installed if necessary.
+func persistentCommand(app *appcorev1.CliApp, cmdline []string) ([]string, error) {
+	// tmux runs in the builtin context rather than the custom one.
+	distro, err := utils.LookupDistro(string(app.Spec.Distro))
+	if err != nil {
+		return nil, err
+	}
+
+	install, err := installScript(distro.PackageManager, "tmux")
+	if err != nil {
+		return nil, err
+	}
+
+	script := fmt.Sprintf(`%s
+export TERM="${TERM:-xterm}"
+exec tmux new-session -A -s %s %s \; set-option status off`, install, persistentSession,
+		utils.ShellQuote(utils.ShellQuote(cmdline...)))
+	return []string{string(app.Spec.Shell), "-c", script}, nil
+}
@@ -0,0 +1,145 @@
+package cmd
+
+import (
+	"context"
+	"fmt"
+	"github.com/warm-metal/kubectl-dev/pkg/utils"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"sort"
+)
+
+// selectPod chooses one of the Pods matching the label selector or created by the target workload.
+// The Pod at --pod-index is chosen if set. Otherwise, users choose one interactively if more than one matched.
+func (o *DebugOptions) selectPod(ctx context.Context) (*corev1.Pod, error) {
+	clientset, err := o.ClientSet()
+	if err != nil {
+		return nil, err
+	}
+
+	var pods []corev1.Pod
+	if len(o.selector) > 0 {
+		list, err := clientset.CoreV1().Pods(o.namespace).List(ctx, metav1.ListOptions{LabelSelector: o.selector})
+		if err != nil {
+			return nil, err
+		}
+
+		if len(list.Items) == 0 {
+			return nil, fmt.Errorf(`no Pod matches "%s" in namespace %s`, o.selector, o.namespace)
+		}
+
+		pods = list.Items
+	} else {
+		workload, err := utils.FetchWorkload(o.Raw(), o.namespace, o.kindAndName)
+		if err != nil {
+			return nil, err
+		}
+
+		if workload.Pod != nil {
+			return workload.Pod, nil
+		}
+
+		if pods, err = workload.ListPods(ctx, clientset); err != nil {
+			return nil, err
+		}
+
+		if len(pods) == 0 {
+			return nil, fmt.Errorf("no Pod of %s found in namespace %s", o.kindAndName, workload.Namespace)
+		}
+	}
+
+	sort.Slice(pods, func(i, j int) bool {
+		return pods[i].Name < pods[j].Name
+	})
+
+	if o.podIndex >= len(pods) {
+		return nil, fmt.Errorf("pod index %d out of range. %d Pods found", o.podIndex, len(pods))
+	}
+
+	if o.podIndex >= 0 {
+		return &pods[o.podIndex], nil
+	}
+
+	if len(pods) == 1 {
+		return &pods[0], nil
+	}
+
+	options := make([]string, len(pods))
+	for i := range pods {
+		pod := &pods[i]
+		restarts := int32(0)
+		for _, status := range pod.Status.ContainerStatuses {
+			restarts += status.RestartCount
+		}
+
+		options[i] = fmt.Sprintf("%s\t%s\t%s\tready=%t\trestarts=%d", pod.Name, pod.Spec.NodeName,
+			pod.Status.Phase, utils.IsPodReady(pod), restarts)
+	}
+
+	i, err := utils.Choose(o.In, o.Out, "Choose a Pod to debug", options)
+	if err != nil {
+		return nil, err
+	}
+
+	return &pods[i], nil
+}
+
+// chooseContainer determines the target container of the workload, which could be either a regular or an init
+// container. If not specified, users choose one interactively if the Pod has more than one regular container or an
+// abnormal init container.
+func (o *DebugOptions) chooseContainer() error {
+	spec := &o.workload.Template.Spec
+	if len(o.container) > 0 {
+		_, init, err := utils.FindContainerOrInitContainer(spec, o.container)
+		o.initContainer = init
+		return err
+	}
+
+	statuses := map[string]*corev1.ContainerStatus{}
+	abnormalInit := false
+	if o.workload.Pod != nil {
+		for i := range o.workload.Pod.Status.InitContainerStatuses {
+			status := &o.workload.Pod.Status.InitContainerStatuses[i]
+			statuses[status.Name] = status
+			abnormalInit = abnormalInit || utils.IsContainerAbnormal(status)
+		}
+
+		for i := range o.workload.Pod.Status.ContainerStatuses {
+			status := &o.workload.Pod.Status.ContainerStatuses[i]
+			statuses[status.Name] = status
+		}
+	}
+
+	if len(spec.Containers) == 1 && !abnormalInit {
+		return nil
+	}
+
+	var names, options []string
+	for i, containers := range [][]corev1.Container{spec.InitContainers, spec.Containers} {
+		for _, c := range containers {
+			option := fmt.Sprintf("%s\t%s", c.Name, c.Image)
+			if i == 0 {
+				option += "\tinit"
+			}
+
+			if status := statuses[c.Name]; status != nil {
+				option += fmt.Sprintf("\tready=%t\trestarts=%d", status.Ready, status.RestartCount)
+				if status.State.Waiting != nil && len(status.State.Waiting.Reason) > 0 {
+					option += "\t" + status.State.Waiting.Reason
+				}
+			}
+
+			names = append(names, c.Name)
+			options = append(options, option)
+		}
+	}
+
+	i, err := utils.Choose(o.In, o.Out, "Choose a container to debug", options)
+	if err != nil {
+		return err
+	}
+
+	o.container = names[i]
+	o.initContainer = i < len(spec.InitContainers)
+	return nil
+}
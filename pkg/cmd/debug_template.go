@@ -0,0 +1,478 @@
+package cmd
+
+import (
+	"context"
+	"fmt"
+	appcorev1 "github.com/warm-metal/cliapp/pkg/apis/cliapp/v1"
+	"github.com/warm-metal/kubectl-dev/pkg/utils"
+	appsv1 "k8s.io/api/apps/v1"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/labels"
+	"k8s.io/client-go/kubernetes"
+	"path/filepath"
+	"strings"
+	"unicode/utf8"
+)
+
+const (
+	forkTemplateLabel  = "debugger.kubectl-dev.warm-metal.tech"
+	csiImageDriverName = "csi-image.warm-metal.tech"
+
+	// debugContextRoot is where the custom context image is mounted. Sessions chroot to it after /app-root is
+	// mounted into it.
+	debugContextRoot        = "/debug-context"
+	debugContextMountScript = `grep -qs " ` + debugContextRoot + `/app-root " /proc/mounts || ` +
+		`{ mkdir -p ` + debugContextRoot + `/app-root ` + debugContextRoot + `/proc && ` +
+		`mount --rbind /app-root ` + debugContextRoot + `/app-root && ` +
+		`mount -t proc proc ` + debugContextRoot + `/proc; } || ` +
+		`echo "Unable to mount /app-root in the debug context" >&2`
+)
+
+// forkTemplate is a ReplicaSet which is never scaled up. It carries a modified copy of the target Pod template and
+// is forked by the debugger instead of the original object. ConfigMaps and Secrets it mounts instead of the original
+// ones are also created along with it. All these objects are owned by the debugger CliApp.
+type forkTemplate struct {
+	rs         *appsv1.ReplicaSet
+	container  string
+	configMaps []*corev1.ConfigMap
+	secrets    []*corev1.Secret
+}
+
+// clearPodOnlyFields clears fields of a Pod spec which are set by the scheduler or admission controllers, or are
+// invalid in Pod templates, such that specs of running Pods can be used as templates.
+func clearPodOnlyFields(spec *corev1.PodSpec) {
+	spec.NodeName = ""
+	spec.EphemeralContainers = nil
+	// Fields below are filled by admission controllers according to the PriorityClass or the RuntimeClass.
+	// Pods are rejected if they are set but different from the computed ones.
+	spec.Priority = nil
+	spec.PreemptionPolicy = nil
+	spec.Overhead = nil
+}
+
+// dropSelfAntiAffinity removes required Pod anti-affinity terms which select Pods with the labels,
+// and returns the number of terms removed.
+func dropSelfAntiAffinity(affinity *corev1.Affinity, podLabels map[string]string) (dropped int) {
+	if affinity == nil || affinity.PodAntiAffinity == nil {
+		return 0
+	}
+
+	var kept []corev1.PodAffinityTerm
+	for _, term := range affinity.PodAntiAffinity.RequiredDuringSchedulingIgnoredDuringExecution {
+		selector, err := metav1.LabelSelectorAsSelector(term.LabelSelector)
+		if err == nil && selector.Matches(labels.Set(podLabels)) {
+			dropped++
+			continue
+		}
+
+		kept = append(kept, term)
+	}
+
+	affinity.PodAntiAffinity.RequiredDuringSchedulingIgnoredDuringExecution = kept
+	return dropped
+}
+
+// needForkTemplate returns true if the target Pod spec must be modified before forking.
+// Pods are always forked via templates since their node names must be cleared to be rescheduled.
+func (o *DebugOptions) needForkTemplate() bool {
+	return len(o.overrideConfigMaps) > 0 || len(o.overrideSecrets) > 0 || len(o.emptyDirs) > 0 ||
+		len(o.contextImage) > 0 || o.initContainer || o.allContainers || (o.workload != nil && o.workload.Pod != nil)
+}
+
+func (o *DebugOptions) buildForkTemplate() (*forkTemplate, error) {
+	tmpl := &corev1.PodTemplateSpec{
+		Spec: corev1.PodSpec{
+			Containers: []corev1.Container{{Name: "debugger", Image: o.image}},
+		},
+	}
+
+	if o.workload != nil {
+		tmpl = &corev1.PodTemplateSpec{
+			ObjectMeta: metav1.ObjectMeta{
+				Labels:      o.workload.Template.Labels,
+				Annotations: o.workload.Template.Annotations,
+			},
+			Spec: *o.workload.Template.Spec.DeepCopy(),
+		}
+	}
+
+	clearPodOnlyFields(&tmpl.Spec)
+	if len(o.node) > 0 {
+		if dropped := dropSelfAntiAffinity(tmpl.Spec.Affinity, tmpl.Labels); dropped > 0 {
+			fmt.Fprintf(o.ErrOut, "%d required Pod anti-affinity terms matching the target are dropped. "+
+				"Otherwise, the debugger can't be scheduled on node %s along with the target.\n", dropped, o.node)
+		}
+
+		tmpl.Spec.Affinity = utils.RequireNode(tmpl.Spec.Affinity, o.node)
+	}
+
+	if o.initContainer {
+		promoteInitContainer(&tmpl.Spec, o.container)
+	}
+
+	container, err := utils.FindContainer(&tmpl.Spec, o.container)
+	if err != nil {
+		return nil, err
+	}
+
+	switch o.withVolumes {
+	case volumesReadOnly:
+		setClaimsReadOnly(&tmpl.Spec)
+	case volumesReadWrite:
+	default:
+		if claims := replaceClaimsWithEmptyDirs(&tmpl.Spec); len(claims) > 0 {
+			fmt.Fprintf(o.ErrOut, "PersistentVolumeClaims %v are replaced with empty directories. "+
+				"Use --with-volumes to attach them.\n", claims)
+		}
+	}
+
+	if o.allContainers {
+		mountContainerImages(&tmpl.Spec, container, &o.workload.Template.Spec)
+	}
+
+	if len(o.image) > 0 {
+		container.Image = o.image
+	}
+
+	t := &forkTemplate{container: container.Name}
+	if tmpl.Labels == nil {
+		tmpl.Labels = map[string]string{}
+	}
+
+	tmpl.Labels[forkTemplateLabel] = o.instance
+
+	for _, override := range o.overrideConfigMaps {
+		name, path, err := parseOverride(override)
+		if err != nil {
+			return nil, err
+		}
+
+		data, err := utils.ReadDataFromPath(path)
+		if err != nil {
+			return nil, err
+		}
+
+		cm := &corev1.ConfigMap{
+			ObjectMeta: metav1.ObjectMeta{
+				Name:      fmt.Sprintf("%s-cm-%s", o.instance, name),
+				Namespace: o.namespace,
+			},
+			Data:       map[string]string{},
+			BinaryData: map[string][]byte{},
+		}
+
+		for k, v := range data {
+			if utf8.Valid(v) {
+				cm.Data[k] = string(v)
+			} else {
+				cm.BinaryData[k] = v
+			}
+		}
+
+		if !replaceConfigMapVolumes(&tmpl.Spec, name, cm.Name) {
+			return nil, fmt.Errorf("ConfigMap %s isn't mounted by %s", name, o.kindAndName)
+		}
+
+		t.configMaps = append(t.configMaps, cm)
+	}
+
+	for _, override := range o.overrideSecrets {
+		name, path, err := parseOverride(override)
+		if err != nil {
+			return nil, err
+		}
+
+		data, err := utils.ReadDataFromPath(path)
+		if err != nil {
+			return nil, err
+		}
+
+		secret := &corev1.Secret{
+			ObjectMeta: metav1.ObjectMeta{
+				Name:      fmt.Sprintf("%s-secret-%s", o.instance, name),
+				Namespace: o.namespace,
+			},
+			Data: data,
+		}
+
+		if !replaceSecretVolumes(&tmpl.Spec, name, secret.Name) {
+			return nil, fmt.Errorf("Secret %s isn't mounted by %s", name, o.kindAndName)
+		}
+
+		t.secrets = append(t.secrets, secret)
+	}
+
+	for i, mountPoint := range o.emptyDirs {
+		volume := fmt.Sprintf("debugger-emptydir-%d", i)
+		tmpl.Spec.Volumes = append(tmpl.Spec.Volumes, corev1.Volume{
+			Name:         volume,
+			VolumeSource: corev1.VolumeSource{EmptyDir: &corev1.EmptyDirVolumeSource{}},
+		})
+		container.VolumeMounts = append(container.VolumeMounts, corev1.VolumeMount{
+			Name:      volume,
+			MountPath: mountPoint,
+		})
+	}
+
+	if len(o.contextImage) > 0 {
+		tmpl.Spec.Volumes = append(tmpl.Spec.Volumes, corev1.Volume{
+			Name: "debug-context",
+			VolumeSource: corev1.VolumeSource{
+				CSI: &corev1.CSIVolumeSource{
+					Driver:           csiImageDriverName,
+					VolumeAttributes: map[string]string{"image": o.contextImage},
+				},
+			},
+		})
+		container.VolumeMounts = append(container.VolumeMounts, corev1.VolumeMount{
+			Name:      "debug-context",
+			MountPath: debugContextRoot,
+		})
+	}
+
+	replicas := int32(0)
+	t.rs = &appsv1.ReplicaSet{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      o.instance + "-template",
+			Namespace: o.namespace,
+		},
+		Spec: appsv1.ReplicaSetSpec{
+			Replicas: &replicas,
+			Selector: &metav1.LabelSelector{
+				MatchLabels: map[string]string{forkTemplateLabel: o.instance},
+			},
+			Template: *tmpl,
+		},
+	}
+
+	return t, nil
+}
+
+// promoteInitContainer makes the init container the only regular container, such that it can be forked.
+// Init containers before it are kept to prepare the environment, while the following ones are dropped.
+func promoteInitContainer(spec *corev1.PodSpec, name string) {
+	for i := range spec.InitContainers {
+		if spec.InitContainers[i].Name == name {
+			spec.Containers = []corev1.Container{spec.InitContainers[i]}
+			spec.InitContainers = spec.InitContainers[:i]
+			return
+		}
+	}
+}
+
+// mountContainerImages mounts images of all containers in the original Pod spec, except the target, to the target
+// container at /app-root/<container>.
+func mountContainerImages(spec *corev1.PodSpec, target *corev1.Container, original *corev1.PodSpec) {
+	n := 0
+	for _, containers := range [][]corev1.Container{original.InitContainers, original.Containers} {
+		for _, c := range containers {
+			if c.Name == target.Name {
+				continue
+			}
+
+			volume := fmt.Sprintf("debugger-image-%d", n)
+			n++
+			spec.Volumes = append(spec.Volumes, corev1.Volume{
+				Name: volume,
+				VolumeSource: corev1.VolumeSource{
+					CSI: &corev1.CSIVolumeSource{
+						Driver:           csiImageDriverName,
+						VolumeAttributes: map[string]string{"image": c.Image},
+					},
+				},
+			})
+			target.VolumeMounts = append(target.VolumeMounts, corev1.VolumeMount{
+				Name:      volume,
+				MountPath: filepath.Join("/app-root", c.Name),
+			})
+		}
+	}
+}
+
+func parseOverride(override string) (name, path string, err error) {
+	kv := strings.SplitN(override, "=", 2)
+	if len(kv) != 2 || len(kv[0]) == 0 || len(kv[1]) == 0 {
+		return "", "", fmt.Errorf(`override "%s" must be in the form of "name=local-path"`, override)
+	}
+
+	return kv[0], kv[1], nil
+}
+
+func replaceConfigMapVolumes(spec *corev1.PodSpec, from, to string) (replaced bool) {
+	for i := range spec.Volumes {
+		volume := &spec.Volumes[i]
+		if volume.ConfigMap != nil && volume.ConfigMap.Name == from {
+			volume.ConfigMap.Name = to
+			replaced = true
+		}
+
+		if volume.Projected == nil {
+			continue
+		}
+
+		for j := range volume.Projected.Sources {
+			source := &volume.Projected.Sources[j]
+			if source.ConfigMap != nil && source.ConfigMap.Name == from {
+				source.ConfigMap.Name = to
+				replaced = true
+			}
+		}
+	}
+
+	return
+}
+
+func replaceSecretVolumes(spec *corev1.PodSpec, from, to string) (replaced bool) {
+	for i := range spec.Volumes {
+		volume := &spec.Volumes[i]
+		if volume.Secret != nil && volume.Secret.SecretName == from {
+			volume.Secret.SecretName = to
+			replaced = true
+		}
+
+		if volume.Projected == nil {
+			continue
+		}
+
+		for j := range volume.Projected.Sources {
+			source := &volume.Projected.Sources[j]
+			if source.Secret != nil && source.Secret.Name == from {
+				source.Secret.Name = to
+				replaced = true
+			}
+		}
+	}
+
+	return
+}
+
+// parseVolume parses a volume in the form of "hostpath:mount-point" or "emptyDir:mount-point".
+func parseVolume(volume string) (hostPath, mountPoint string, err error) {
+	pair := strings.SplitN(volume, ":", 2)
+	if len(pair) != 2 || !filepath.IsAbs(pair[1]) {
+		return "", "", fmt.Errorf(`volume "%s" must be in the form of "hostpath:mount-point" or "emptyDir:mount-point"`,
+			volume)
+	}
+
+	if strings.ToLower(pair[0]) == "emptydir" {
+		return "", pair[1], nil
+	}
+
+	if !filepath.IsAbs(pair[0]) {
+		return "", "", fmt.Errorf(`host path of volume "%s" must be an absolute path`, volume)
+	}
+
+	return pair[0], pair[1], nil
+}
+
+func (t *forkTemplate) apply(ctx context.Context, clientset *kubernetes.Clientset) error {
+	for _, cm := range t.configMaps {
+		client := clientset.CoreV1().ConfigMaps(cm.Namespace)
+		if _, err := client.Create(ctx, cm, metav1.CreateOptions{}); err != nil {
+			if !errors.IsAlreadyExists(err) {
+				return err
+			}
+
+			if _, err = client.Update(ctx, cm, metav1.UpdateOptions{}); err != nil {
+				return err
+			}
+		}
+	}
+
+	for _, secret := range t.secrets {
+		client := clientset.CoreV1().Secrets(secret.Namespace)
+		if _, err := client.Create(ctx, secret, metav1.CreateOptions{}); err != nil {
+			if !errors.IsAlreadyExists(err) {
+				return err
+			}
+
+			if _, err = client.Update(ctx, secret, metav1.UpdateOptions{}); err != nil {
+				return err
+			}
+		}
+	}
+
+	client := clientset.AppsV1().ReplicaSets(t.rs.Namespace)
+	rs, err := client.Get(ctx, t.rs.Name, metav1.GetOptions{})
+	if errors.IsNotFound(err) {
+		t.rs, err = client.Create(ctx, t.rs, metav1.CreateOptions{})
+		return err
+	}
+
+	if err != nil {
+		return err
+	}
+
+	rs.Spec.Template = t.rs.Spec.Template
+	t.rs, err = client.Update(ctx, rs, metav1.UpdateOptions{})
+	return err
+}
+
+// adopt sets the debugger CliApp as the owner of all template objects. They will be garbage collected along with the
+// CliApp.
+func (t *forkTemplate) adopt(ctx context.Context, clientset *kubernetes.Clientset, app *appcorev1.CliApp) error {
+	owner := []metav1.OwnerReference{{
+		APIVersion: appcorev1.GroupVersion.String(),
+		Kind:       "CliApp",
+		Name:       app.Name,
+		UID:        app.UID,
+	}}
+
+	for _, cm := range t.configMaps {
+		cm.OwnerReferences = owner
+		if _, err := clientset.CoreV1().ConfigMaps(cm.Namespace).Update(ctx, cm, metav1.UpdateOptions{}); err != nil {
+			return err
+		}
+	}
+
+	for _, secret := range t.secrets {
+		secret.OwnerReferences = owner
+		if _, err := clientset.CoreV1().Secrets(secret.Namespace).Update(ctx, secret, metav1.UpdateOptions{}); err != nil {
+			return err
+		}
+	}
+
+	t.rs.OwnerReferences = owner
+	_, err := clientset.AppsV1().ReplicaSets(t.rs.Namespace).Update(ctx, t.rs, metav1.UpdateOptions{})
+	return err
+}
+
+func (t *forkTemplate) forkObject(withEnvs bool) *appcorev1.ForkObject {
+	return &appcorev1.ForkObject{
+		Object:    "replicaset/" + t.rs.Name,
+		Container: t.container,
+		WithEnvs:  withEnvs,
+	}
+}
+
+// checkNode warns if the debugger may not be scheduled on the node it is pinned to.
+func (o *DebugOptions) checkNode(ctx context.Context, clientset *kubernetes.Clientset, spec *corev1.PodSpec) {
+	node, err := clientset.CoreV1().Nodes().Get(ctx, o.node, metav1.GetOptions{})
+	if err != nil {
+		fmt.Fprintf(o.ErrOut, "unable to check node %s: %s\n", o.node, err)
+		return
+	}
+
+	if node.Spec.Unschedulable {
+		fmt.Fprintf(o.ErrOut, "Warning: node %s is cordoned. The debugger may not be scheduled.\n", node.Name)
+	}
+
+	for _, taint := range utils.GetUntoleratedTaints(node.Spec.Taints, spec.Tolerations) {
+		fmt.Fprintf(o.ErrOut, "Warning: node %s has taint %s which the target doesn't tolerate.\n",
+			node.Name, taint.ToString())
+	}
+
+	free, err := utils.GetNodeFreeResources(ctx, clientset, node)
+	if err != nil {
+		fmt.Fprintf(o.ErrOut, "unable to check capacity of node %s: %s\n", o.node, err)
+		return
+	}
+
+	for _, name := range utils.GetInsufficientResources(utils.GetPodRequests(spec), free) {
+		quantity := free[name]
+		fmt.Fprintf(o.ErrOut, "Warning: node %s has only %s %s left. The debugger may not be scheduled.\n",
+			node.Name, quantity.String(), name)
+	}
+}
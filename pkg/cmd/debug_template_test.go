@@ -0,0 +1,180 @@
+package cmd
+
+import (
+	"github.com/warm-metal/kubectl-dev/pkg/utils"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/resource"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/cli-runtime/pkg/genericclioptions"
+	"reflect"
+	"testing"
+)
+
+func TestBuildForkTemplate(t *testing.T) {
+	zone := corev1.NodeSelectorRequirement{
+		Key:      "topology.kubernetes.io/zone",
+		Operator: corev1.NodeSelectorOpIn,
+		Values:   []string{"a"},
+	}
+
+	onNode := corev1.NodeSelectorRequirement{
+		Key:      "metadata.name",
+		Operator: corev1.NodeSelectorOpIn,
+		Values:   []string{"node-1"},
+	}
+
+	preferred := []corev1.PreferredSchedulingTerm{{
+		Weight:     1,
+		Preference: corev1.NodeSelectorTerm{MatchExpressions: []corev1.NodeSelectorRequirement{zone}},
+	}}
+
+	podTerm := func(app string) corev1.PodAffinityTerm {
+		return corev1.PodAffinityTerm{
+			LabelSelector: &metav1.LabelSelector{MatchLabels: map[string]string{"app": app}},
+			TopologyKey:   "kubernetes.io/hostname",
+		}
+	}
+
+	priority := int32(1000)
+	preemption := corev1.PreemptNever
+
+	tests := []struct {
+		name         string
+		spec         corev1.PodSpec
+		node         string
+		wantAffinity *corev1.Affinity
+	}{
+		{
+			name: "pod-only fields",
+			spec: corev1.PodSpec{
+				NodeName:            "node-1",
+				EphemeralContainers: []corev1.EphemeralContainer{{}},
+				PriorityClassName:   "high",
+				Priority:            &priority,
+				PreemptionPolicy:    &preemption,
+				Overhead:            corev1.ResourceList{corev1.ResourceCPU: resource.MustParse("250m")},
+			},
+		},
+		{
+			name: "node without affinity",
+			node: "node-1",
+			wantAffinity: &corev1.Affinity{NodeAffinity: &corev1.NodeAffinity{
+				RequiredDuringSchedulingIgnoredDuringExecution: &corev1.NodeSelector{
+					NodeSelectorTerms: []corev1.NodeSelectorTerm{{
+						MatchFields: []corev1.NodeSelectorRequirement{onNode},
+					}},
+				},
+			}},
+		},
+		{
+			name: "node merged into node affinity",
+			spec: corev1.PodSpec{Affinity: &corev1.Affinity{NodeAffinity: &corev1.NodeAffinity{
+				RequiredDuringSchedulingIgnoredDuringExecution: &corev1.NodeSelector{
+					NodeSelectorTerms: []corev1.NodeSelectorTerm{
+						{MatchExpressions: []corev1.NodeSelectorRequirement{zone}},
+						{MatchFields: []corev1.NodeSelectorRequirement{zone}},
+					},
+				},
+				PreferredDuringSchedulingIgnoredDuringExecution: preferred,
+			}}},
+			node: "node-1",
+			wantAffinity: &corev1.Affinity{NodeAffinity: &corev1.NodeAffinity{
+				RequiredDuringSchedulingIgnoredDuringExecution: &corev1.NodeSelector{
+					NodeSelectorTerms: []corev1.NodeSelectorTerm{
+						{
+							MatchExpressions: []corev1.NodeSelectorRequirement{zone},
+							MatchFields:      []corev1.NodeSelectorRequirement{onNode},
+						},
+						{MatchFields: []corev1.NodeSelectorRequirement{zone, onNode}},
+					},
+				},
+				PreferredDuringSchedulingIgnoredDuringExecution: preferred,
+			}},
+		},
+		{
+			name: "anti-affinity against the target dropped on the same node",
+			spec: corev1.PodSpec{Affinity: &corev1.Affinity{
+				PodAffinity: &corev1.PodAffinity{
+					RequiredDuringSchedulingIgnoredDuringExecution: []corev1.PodAffinityTerm{podTerm("cache")},
+				},
+				PodAntiAffinity: &corev1.PodAntiAffinity{
+					RequiredDuringSchedulingIgnoredDuringExecution: []corev1.PodAffinityTerm{
+						podTerm("web"), podTerm("db"),
+					},
+					PreferredDuringSchedulingIgnoredDuringExecution: []corev1.WeightedPodAffinityTerm{
+						{Weight: 1, PodAffinityTerm: podTerm("web")},
+					},
+				},
+			}},
+			node: "node-1",
+			wantAffinity: &corev1.Affinity{
+				NodeAffinity: &corev1.NodeAffinity{
+					RequiredDuringSchedulingIgnoredDuringExecution: &corev1.NodeSelector{
+						NodeSelectorTerms: []corev1.NodeSelectorTerm{{
+							MatchFields: []corev1.NodeSelectorRequirement{onNode},
+						}},
+					},
+				},
+				PodAffinity: &corev1.PodAffinity{
+					RequiredDuringSchedulingIgnoredDuringExecution: []corev1.PodAffinityTerm{podTerm("cache")},
+				},
+				PodAntiAffinity: &corev1.PodAntiAffinity{
+					RequiredDuringSchedulingIgnoredDuringExecution: []corev1.PodAffinityTerm{podTerm("db")},
+					PreferredDuringSchedulingIgnoredDuringExecution: []corev1.WeightedPodAffinityTerm{
+						{Weight: 1, PodAffinityTerm: podTerm("web")},
+					},
+				},
+			},
+		},
+		{
+			name: "anti-affinity against the target kept on other nodes",
+			spec: corev1.PodSpec{Affinity: &corev1.Affinity{PodAntiAffinity: &corev1.PodAntiAffinity{
+				RequiredDuringSchedulingIgnoredDuringExecution: []corev1.PodAffinityTerm{podTerm("web")},
+			}}},
+			wantAffinity: &corev1.Affinity{PodAntiAffinity: &corev1.PodAntiAffinity{
+				RequiredDuringSchedulingIgnoredDuringExecution: []corev1.PodAffinityTerm{podTerm("web")},
+			}},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			tt.spec.Containers = []corev1.Container{{Name: "web", Image: "nginx"}}
+			target := &corev1.PodTemplateSpec{
+				ObjectMeta: metav1.ObjectMeta{Labels: map[string]string{"app": "web"}},
+				Spec:       tt.spec,
+			}
+
+			original := target.Spec.DeepCopy()
+			o := &DebugOptions{
+				IOStreams: genericclioptions.NewTestIOStreamsDiscard(),
+				workload:  &utils.Workload{Kind: "Pod", Name: "web", Template: target},
+				node:      tt.node,
+				instance:  "debugger",
+			}
+
+			fork, err := o.buildForkTemplate()
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			spec := &fork.rs.Spec.Template.Spec
+			if len(spec.NodeName) > 0 || spec.EphemeralContainers != nil || spec.Priority != nil ||
+				spec.PreemptionPolicy != nil || spec.Overhead != nil {
+				t.Errorf("Pod-only fields are not cleared: %+v", spec)
+			}
+
+			if spec.PriorityClassName != tt.spec.PriorityClassName {
+				t.Errorf("PriorityClassName = %q, want %q", spec.PriorityClassName, tt.spec.PriorityClassName)
+			}
+
+			if !reflect.DeepEqual(spec.Affinity, tt.wantAffinity) {
+				t.Errorf("Affinity = %+v, want %+v", spec.Affinity, tt.wantAffinity)
+			}
+
+			if !reflect.DeepEqual(&target.Spec, original) {
+				t.Errorf("spec of the target is modified: %+v", target.Spec)
+			}
+		})
+	}
+}
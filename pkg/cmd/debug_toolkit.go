@@ -0,0 +1,149 @@
+package cmd
+
+import (
+	"fmt"
+	appcorev1 "github.com/warm-metal/cliapp/pkg/apis/cliapp/v1"
+	"github.com/warm-metal/kubectl-dev/pkg/kubectl"
+	"github.com/warm-metal/kubectl-dev/pkg/utils"
+	"os"
+	"sort"
+	"strings"
+	"time"
+)
+
+const (
+	toolkitNet  = "net"
+	toolkitPerf = "perf"
+	toolkitAll  = "all"
+)
+
+// packageInstallers maps package managers to commands installing packages.
+var packageInstallers = map[string]string{
+	"apk":      "apk add --no-cache",
+	"apt":      "apt-get update -qq && DEBIAN_FRONTEND=noninteractive apt-get install -y -qq --no-install-recommends",
+	"dnf":      "dnf install -y -q",
+	"yum":      "yum install -y -q",
+	"microdnf": "microdnf install -y",
+	"zypper":   "zypper --non-interactive install",
+}
+
+// toolkits maps toolkit names to tools and the package providing each tool for each package manager.
+// The tool name is used if the package manager is absent.
+var toolkits = map[string]map[string]map[string]string{
+	toolkitNet: {
+		"tcpdump": {},
+		"curl":    {},
+		"dig":     {"apk": "bind-tools", "apt": "dnsutils", "dnf": "bind-utils", "yum": "bind-utils", "microdnf": "bind-utils", "zypper": "bind-utils"},
+		"ss":      {"apk": "iproute2", "apt": "iproute2", "dnf": "iproute", "yum": "iproute", "microdnf": "iproute", "zypper": "iproute2"},
+	},
+	toolkitPerf: {
+		"perf":   {"apt": "linux-tools-generic"},
+		"strace": {},
+		"ltrace": {},
+	},
+}
+
+func validateToolkit(toolkit string) error {
+	switch toolkit {
+	case "", toolkitNet, toolkitPerf, toolkitAll:
+		return nil
+	default:
+		return fmt.Errorf("toolkit must be one of %s, %s, or %s", toolkitNet, toolkitPerf, toolkitAll)
+	}
+}
+
+// toolkitTools returns tools in the toolkit.
+func toolkitTools(toolkit string) []string {
+	var tools []string
+	for name, kit := range toolkits {
+		if toolkit != toolkitAll && toolkit != name {
+			continue
+		}
+
+		for tool := range kit {
+			tools = append(tools, tool)
+		}
+	}
+
+	sort.Strings(tools)
+	return tools
+}
+
+// installScript returns a shell script which installs missing tools via the package manager.
+func installScript(packageManager string, tools ...string) (string, error) {
+	installer, found := packageInstallers[packageManager]
+	if !found {
+		return "", fmt.Errorf("package manager %q of the distro is not supported to install tools", packageManager)
+	}
+
+	lines := []string{`missing=""`}
+	for _, tool := range tools {
+		pkg := tool
+		for _, kit := range toolkits {
+			if p, found := kit[tool][packageManager]; found {
+				pkg = p
+			}
+		}
+
+		lines = append(lines, fmt.Sprintf(`command -v %s >/dev/null 2>&1 || missing="$missing %s"`, tool, pkg))
+	}
+
+	lines = append(lines, fmt.Sprintf(
+		`[ -z "$missing" ] || { echo "Installing$missing" >&2; %s $missing >/dev/null; }`, installer))
+	return strings.Join(lines, "\n"), nil
+}
+
+// capturePidFile keeps the pid of tcpdump in the debugger, such that it can be stopped remotely.
+const capturePidFile = "/tmp/kubectl-dev-capture.pid"
+
+// captureStopTimeout is how long to wait for tcpdump to exit after being interrupted.
+const captureStopTimeout = 5 * time.Second
+
+// startCapture runs tcpdump in the debugger Pod and writes the captured packets to the local file.
+// The returned function stops capturing. tcpdump is interrupted in the Pod, since closing the exec stream
+// doesn't stop it. A capture left by a previous session is also stopped before starting.
+func (o *DebugOptions) startCapture(app *appcorev1.CliApp) (stop func(), err error) {
+	// tcpdump runs in the builtin context rather than the custom one.
+	distro, err := utils.LookupDistro(string(app.Spec.Distro))
+	if err != nil {
+		return nil, err
+	}
+
+	install, err := installScript(distro.PackageManager, "tcpdump")
+	if err != nil {
+		return nil, err
+	}
+
+	pcap, err := os.Create(utils.ExpandTilde(o.capture))
+	if err != nil {
+		return nil, err
+	}
+
+	script := fmt.Sprintf(`%s
+[ -f %[2]s ] && kill -INT "$(cat %[2]s)" 2>/dev/null
+echo $$ >%[2]s
+exec tcpdump -i any -U -w -`, install, capturePidFile)
+	exited := o.StartExec(app.Status.PodName, app.Namespace, utils.AppContainer,
+		[]string{string(app.Spec.Shell), "-c", script}, kubectl.WithStdout(pcap), kubectl.WithStderr(o.ErrOut))
+
+	fmt.Fprintf(o.ErrOut, "Capturing packets of Pod %s to %s\n", app.Status.PodName, o.capture)
+	return func() {
+		defer pcap.Close()
+		kill := fmt.Sprintf(`kill -INT "$(cat %[1]s)" && rm -f %[1]s`, capturePidFile)
+		err := o.RunExec(app.Status.PodName, app.Namespace, utils.AppContainer, false,
+			[]string{string(app.Spec.Shell), "-c", kill}, kubectl.WithStderr(o.ErrOut))
+		if err != nil {
+			fmt.Fprintf(o.ErrOut, "unable to stop tcpdump in Pod %s: %s\n", app.Status.PodName, err)
+		}
+
+		select {
+		case err := <-exited:
+			if err != nil {
+				fmt.Fprintf(o.ErrOut, "tcpdump in Pod %s exited: %s\n", app.Status.PodName, err)
+			}
+		case <-time.After(captureStopTimeout):
+			fmt.Fprintf(o.ErrOut, "tcpdump in Pod %s doesn't exit. The capture may be incomplete.\n",
+				app.Status.PodName)
+		}
+	}, nil
+}
@@ -0,0 +1,209 @@
+package cmd
+
+import (
+	"context"
+	"fmt"
+	"github.com/warm-metal/kubectl-dev/pkg/utils"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/util/wait"
+	"k8s.io/client-go/kubernetes"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const (
+	volumesReadOnly  = "ro"
+	volumesReadWrite = "rw"
+
+	replicaTerminationTimeout = 5 * time.Minute
+)
+
+func validateVolumesMode(mode string) error {
+	switch mode {
+	case "", volumesReadOnly, volumesReadWrite:
+		return nil
+	default:
+		return fmt.Errorf("--with-volumes must be either %s or %s", volumesReadOnly, volumesReadWrite)
+	}
+}
+
+// prepareVolumes checks PersistentVolumeClaims the target Pod mounts. Read-write access must be confirmed.
+// If a claim can't be attached to the debugger along with the target Pod, users are asked to scale the StatefulSet
+// down to release it.
+func (o *DebugOptions) prepareVolumes(ctx context.Context, clientset *kubernetes.Clientset) error {
+	pod := o.workload.Pod
+	var exclusive []string
+	for _, volume := range pod.Spec.Volumes {
+		if volume.PersistentVolumeClaim == nil {
+			continue
+		}
+
+		claim := volume.PersistentVolumeClaim.ClaimName
+		pvc, err := clientset.CoreV1().PersistentVolumeClaims(pod.Namespace).Get(ctx, claim, metav1.GetOptions{})
+		if err != nil {
+			return fmt.Errorf("unable to fetch PersistentVolumeClaim %s: %s", claim, err)
+		}
+
+		fmt.Fprintf(o.ErrOut, "Attaching PersistentVolumeClaim %s (%s) to %s\n", claim,
+			formatAccessModes(pvc.Spec.AccessModes), volumeMountPaths(&pod.Spec, volume.Name))
+		for _, mode := range pvc.Spec.AccessModes {
+			// ReadWriteOnce volumes can be shared by Pods on the same node.
+			if mode == corev1.ReadWriteOncePod || (mode == corev1.ReadWriteOnce && len(o.node) == 0) {
+				exclusive = append(exclusive, claim)
+			}
+		}
+	}
+
+	if o.withVolumes == volumesReadWrite {
+		confirmed, err := utils.Confirm(o.In, o.ErrOut,
+			fmt.Sprintf("Volumes of Pod %s will be writable in the debugger. Continue", pod.Name))
+		if err != nil {
+			return err
+		}
+
+		if !confirmed {
+			return fmt.Errorf("aborted")
+		}
+	}
+
+	if len(exclusive) == 0 {
+		return nil
+	}
+
+	return o.releaseVolumes(ctx, clientset, exclusive)
+}
+
+// releaseVolumes scales the StatefulSet down to terminate the target replica and all replicas after it.
+func (o *DebugOptions) releaseVolumes(ctx context.Context, clientset *kubernetes.Clientset, claims []string) error {
+	pod := o.workload.Pod
+	owner := metav1.GetControllerOf(pod)
+	sep := strings.LastIndex(pod.Name, "-")
+	if owner == nil || owner.Kind != "StatefulSet" || sep < 0 {
+		return fmt.Errorf("volumes %v can't be attached to more than one Pod on different nodes. "+
+			"Enable --same-node or stop Pod %s first", claims, pod.Name)
+	}
+
+	ordinal, err := strconv.Atoi(pod.Name[sep+1:])
+	if err != nil {
+		return fmt.Errorf("unable to parse the ordinal of Pod %s: %s", pod.Name, err)
+	}
+
+	client := clientset.AppsV1().StatefulSets(pod.Namespace)
+	scale, err := client.GetScale(ctx, owner.Name, metav1.GetOptions{})
+	if err != nil {
+		return err
+	}
+
+	replicas := scale.Spec.Replicas
+	var terminated []string
+	for i := ordinal; i < int(replicas); i++ {
+		terminated = append(terminated, fmt.Sprintf("%s-%d", owner.Name, i))
+	}
+
+	confirmed, err := utils.Confirm(o.In, o.ErrOut, fmt.Sprintf(
+		"Volumes %v can't be attached to the debugger while Pod %s is running. "+
+			"Scale StatefulSet %s down from %d to %d replicas, which terminates Pods %s",
+		claims, pod.Name, owner.Name, replicas, ordinal, strings.Join(terminated, ", ")))
+	if err != nil {
+		return err
+	}
+
+	if !confirmed {
+		return fmt.Errorf("aborted")
+	}
+
+	scale.Spec.Replicas = int32(ordinal)
+	if _, err = client.UpdateScale(ctx, owner.Name, scale, metav1.UpdateOptions{}); err != nil {
+		return err
+	}
+
+	scaleBack := fmt.Sprintf("kubectl scale -n %s statefulset/%s --replicas=%d", pod.Namespace, owner.Name, replicas)
+	fmt.Fprintf(o.ErrOut, "Waiting for Pod %s to terminate. Scale it back after debugging via\n  %s\n",
+		pod.Name, scaleBack)
+	waitCtx, cancel := context.WithTimeout(ctx, replicaTerminationTimeout)
+	defer cancel()
+	err = wait.PollImmediateUntil(time.Second, func() (done bool, err error) {
+		_, err = clientset.CoreV1().Pods(pod.Namespace).Get(ctx, pod.Name, metav1.GetOptions{})
+		if errors.IsNotFound(err) {
+			return true, nil
+		}
+
+		return false, err
+	}, waitCtx.Done())
+	if err == wait.ErrWaitTimeout {
+		return fmt.Errorf("Pod %s is still running after %s. Check its finalizers and terminationGracePeriodSeconds, "+
+			"or scale StatefulSet %s back via\n  %s", pod.Name, replicaTerminationTimeout, owner.Name, scaleBack)
+	}
+
+	if err != nil {
+		return fmt.Errorf("unable to wait for Pod %s to terminate: %s. Scale StatefulSet %s back via\n  %s",
+			pod.Name, err, owner.Name, scaleBack)
+	}
+
+	return nil
+}
+
+// setClaimsReadOnly mounts all PersistentVolumeClaims read-only.
+func setClaimsReadOnly(spec *corev1.PodSpec) {
+	claims := map[string]bool{}
+	for i := range spec.Volumes {
+		if claim := spec.Volumes[i].PersistentVolumeClaim; claim != nil {
+			claim.ReadOnly = true
+			claims[spec.Volumes[i].Name] = true
+		}
+	}
+
+	for _, containers := range [][]corev1.Container{spec.InitContainers, spec.Containers} {
+		for i := range containers {
+			for j := range containers[i].VolumeMounts {
+				if mount := &containers[i].VolumeMounts[j]; claims[mount.Name] {
+					mount.ReadOnly = true
+				}
+			}
+		}
+	}
+}
+
+// replaceClaimsWithEmptyDirs replaces all PersistentVolumeClaims with empty directories, such that the debugger
+// neither writes volumes of the target nor waits for them to be released. Names of claims replaced are returned.
+func replaceClaimsWithEmptyDirs(spec *corev1.PodSpec) (claims []string) {
+	for i := range spec.Volumes {
+		volume := &spec.Volumes[i]
+		if volume.PersistentVolumeClaim == nil {
+			continue
+		}
+
+		claims = append(claims, volume.PersistentVolumeClaim.ClaimName)
+		volume.VolumeSource = corev1.VolumeSource{EmptyDir: &corev1.EmptyDirVolumeSource{}}
+	}
+
+	return claims
+}
+
+// volumeMountPaths returns mount points of the volume in all containers.
+func volumeMountPaths(spec *corev1.PodSpec, volume string) string {
+	var paths []string
+	for _, containers := range [][]corev1.Container{spec.InitContainers, spec.Containers} {
+		for _, c := range containers {
+			for _, mount := range c.VolumeMounts {
+				if mount.Name == volume {
+					paths = append(paths, c.Name+":"+mount.MountPath)
+				}
+			}
+		}
+	}
+
+	return strings.Join(paths, ", ")
+}
+
+func formatAccessModes(modes []corev1.PersistentVolumeAccessMode) string {
+	names := make([]string, len(modes))
+	for i, mode := range modes {
+		names[i] = string(mode)
+	}
+
+	return strings.Join(names, ",")
+}
@@ -18,6 +18,7 @@ package cmd
 import (
 	"github.com/spf13/cobra"
 	"github.com/warm-metal/kubectl-dev/pkg/cmd/app"
+	"github.com/warm-metal/kubectl-dev/pkg/cmd/image"
 	"github.com/warm-metal/kubectl-dev/pkg/cmd/opts"
 	"github.com/warm-metal/kubectl-dev/pkg/kubectl"
 	"k8s.io/cli-runtime/pkg/genericclioptions"
@@ -53,7 +54,10 @@ kubectl dev build -t foo:tag -f Dockerfile .`,
 		NewCmdBuild(o, streams),
 		NewCmdLogin(o, streams),
 		NewCmdLogout(o, streams),
+		NewCmdReplay(streams),
+		NewCmdCompletion(streams),
 		app.NewCmd(o, streams),
+		image.NewCmd(o, streams),
 	)
 	cmd.AddCommand(NewVersionCmd())
 
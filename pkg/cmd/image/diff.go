@@ -0,0 +1,233 @@
+package image
+
+import (
+	"context"
+	"fmt"
+	"github.com/spf13/cobra"
+	"github.com/warm-metal/kubectl-dev/pkg/cmd/opts"
+	"github.com/warm-metal/kubectl-dev/pkg/image"
+	"github.com/warm-metal/kubectl-dev/pkg/utils"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/cli-runtime/pkg/genericclioptions"
+	"strings"
+)
+
+type imageDiffOptions struct {
+	*opts.GlobalOptions
+	genericclioptions.IOStreams
+
+	source    imageSource
+	namespace string
+	workload  string
+	container string
+	path      string
+	output    string
+
+	refA string
+	refB string
+}
+
+func (o *imageDiffOptions) Complete(cmd *cobra.Command, args []string) error {
+	if o.Raw().Namespace != nil && len(*o.Raw().Namespace) > 0 {
+		o.namespace = *o.Raw().Namespace
+	}
+
+	if len(o.workload) > 0 {
+		if len(args) != 1 {
+			cmd.SilenceUsage = false
+			return fmt.Errorf("an image is required to compare with the workload")
+		}
+
+		o.refB = args[0]
+		return nil
+	}
+
+	if len(args) != 2 {
+		cmd.SilenceUsage = false
+		return fmt.Errorf("two images are required")
+	}
+
+	o.refA, o.refB = args[0], args[1]
+	return nil
+}
+
+func (o *imageDiffOptions) Validate() error {
+	return validateOutput(o.output)
+}
+
+func (o *imageDiffOptions) Run(ctx context.Context) error {
+	if len(o.workload) > 0 {
+		workload, err := utils.FetchWorkload(o.Raw(), o.namespace, o.workload)
+		if err != nil {
+			return err
+		}
+
+		container, err := utils.FindContainer(&workload.Template.Spec, o.container)
+		if err != nil {
+			return err
+		}
+
+		if o.refA, err = o.runningImage(ctx, workload, container); err != nil {
+			return err
+		}
+	}
+
+	if err := o.source.open(ctx, o.GlobalOptions, o.ErrOut); err != nil {
+		return err
+	}
+
+	defer o.source.close()
+	var imgs [2]*image.Image
+	var trees [2]image.FileTree
+	for i, ref := range []string{o.refA, o.refB} {
+		img, err := o.source.fetch(ctx, ref)
+		if err != nil {
+			return err
+		}
+
+		fmt.Fprintf(o.ErrOut, "Reading %d layers of %s\n", len(img.Manifest.Layers), img.Name)
+		tree, err := o.source.readFileTree(ctx, img, o.path, true)
+		if err != nil {
+			return err
+		}
+
+		imgs[i], trees[i] = img, tree
+	}
+
+	configChanges := image.DiffConfigs(&imgs[0].Config, &imgs[1].Config)
+	fileChanges := image.DiffFileTrees(trees[0], trees[1])
+	if o.output == "json" {
+		return printJSON(o.Out, map[string]interface{}{
+			"from":   imgs[0].Name + "@" + imgs[0].Digest,
+			"to":     imgs[1].Name + "@" + imgs[1].Digest,
+			"config": configChanges,
+			"files":  fileChanges,
+		})
+	}
+
+	fmt.Fprintf(o.Out, "--- %s@%s\n+++ %s@%s\n", imgs[0].Name, imgs[0].Digest, imgs[1].Name, imgs[1].Digest)
+	if len(configChanges) > 0 {
+		fmt.Fprintln(o.Out, "Config:")
+		for _, c := range configChanges {
+			switch {
+			case len(c.Old) == 0:
+				fmt.Fprintf(o.Out, "  + %s: %s\n", c.Field, c.New)
+			case len(c.New) == 0:
+				fmt.Fprintf(o.Out, "  - %s: %s\n", c.Field, c.Old)
+			default:
+				fmt.Fprintf(o.Out, "  ~ %s: %s -> %s\n", c.Field, c.Old, c.New)
+			}
+		}
+	}
+
+	counts := map[image.ChangeKind]int{}
+	if len(fileChanges) > 0 {
+		fmt.Fprintln(o.Out, "Files:")
+		marks := map[image.ChangeKind]string{
+			image.ChangeAdded:    "+",
+			image.ChangeRemoved:  "-",
+			image.ChangeModified: "~",
+		}
+
+		for _, c := range fileChanges {
+			counts[c.Kind]++
+			if len(c.Details) > 0 {
+				fmt.Fprintf(o.Out, "  %s %s (%s)\n", marks[c.Kind], c.Path, strings.Join(c.Details, ", "))
+			} else {
+				fmt.Fprintf(o.Out, "  %s %s\n", marks[c.Kind], c.Path)
+			}
+		}
+	}
+
+	fmt.Fprintf(o.Out, "%d config changes, %d files added, %d removed, %d modified\n", len(configChanges),
+		counts[image.ChangeAdded], counts[image.ChangeRemoved], counts[image.ChangeModified])
+	return nil
+}
+
+// runningImage returns the image the container is running in a Pod of the workload, pinned to its digest.
+// Tags in the Pod spec may have been pushed again since the Pod started.
+func (o *imageDiffOptions) runningImage(ctx context.Context, workload *utils.Workload, container *corev1.Container) (
+	string, error) {
+	clientset, err := o.ClientSet()
+	if err != nil {
+		return "", err
+	}
+
+	pods, err := workload.ListPods(ctx, clientset)
+	if err != nil {
+		return "", err
+	}
+
+	for i := range pods {
+		pod := &pods[i]
+		for _, status := range pod.Status.ContainerStatuses {
+			if status.Name != container.Name || len(status.ImageID) == 0 {
+				continue
+			}
+
+			// The image ID is in the form of "docker-pullable://repo@sha256:..." for docker,
+			// "repo@sha256:..." for containerd, or the ID of the image config if the image is not pulled.
+			imageID := strings.TrimPrefix(status.ImageID, "docker-pullable://")
+			if !strings.Contains(imageID, "@") {
+				fmt.Fprintf(o.ErrOut, "Warning: image %s of Pod %s is not pulled from a registry. Using %s\n",
+					imageID, pod.Name, status.Image)
+				return status.Image, nil
+			}
+
+			fmt.Fprintf(o.ErrOut, "Comparing image %s running in Pod %s\n", imageID, pod.Name)
+			return imageID, nil
+		}
+	}
+
+	return "", fmt.Errorf("container %s isn't running in any Pod of %s/%s", container.Name, workload.Kind,
+		workload.Name)
+}
+
+func newImageDiffCmd(opts *opts.GlobalOptions, streams genericclioptions.IOStreams) *cobra.Command {
+	o := &imageDiffOptions{
+		GlobalOptions: opts,
+		IOStreams:     streams,
+		namespace:     "default",
+	}
+
+	var cmd = &cobra.Command{
+		Use:   "diff [OPTIONS] image-a image-b",
+		Short: "Show differences between two images.",
+		Long: `Show added, removed and modified files, including their content, permissions and owners, and differences
+of the entrypoint, command, environment variables, user and other configs between two images.
+The image running in a Pod of a workload, pinned to its digest, can also be compared with another image.`,
+		Example: `# Show what changed between two tags.
+kubectl dev image diff foo:v1 foo:v2
+
+# Compare the image of a Deployment with a candidate image.
+kubectl dev image diff --workload deploy/foo foo:new-version
+
+# Only compare files under /etc and print the result in JSON.
+kubectl dev image diff foo:v1 foo:v2 --path /etc -o json
+`,
+		SilenceUsage: true,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			if err := o.Complete(cmd, args); err != nil {
+				return err
+			}
+			if err := o.Validate(); err != nil {
+				return err
+			}
+			if err := o.Run(cmd.Context()); err != nil {
+				return err
+			}
+
+			return nil
+		},
+	}
+
+	cmd.Flags().StringVar(&o.workload, "workload", "",
+		`The workload, in the form of "kind/name", whose image is compared with the image.`)
+	cmd.Flags().StringVarP(&o.container, "container", "c", "",
+		"Container of the workload if in which there are multiple containers.")
+	o.source.addFlags(cmd.Flags())
+	cmd.Flags().StringVar(&o.path, "path", "/", "Only compare files under the path.")
+	cmd.Flags().StringVarP(&o.output, "output", "o", "", "Output format. Only json is supported.")
+	o.AddPersistentFlags(cmd.Flags())
+	return cmd
+}
@@ -0,0 +1,24 @@
+package image
+
+import (
+	"github.com/spf13/cobra"
+	"github.com/warm-metal/kubectl-dev/pkg/cmd/opts"
+	"k8s.io/cli-runtime/pkg/genericclioptions"
+)
+
+func NewCmd(opts *opts.GlobalOptions, streams genericclioptions.IOStreams) *cobra.Command {
+	var cmd = &cobra.Command{
+		Use:   "image",
+		Short: "Explore images.",
+		Long: `Explore image configs and file trees without starting a debugger.
+Images are read in the containerd on the node running buildkitd, and for the platform of the node by default.
+Use --registry to fetch them from their registries using credentials saved by "kubectl dev login".`,
+	}
+
+	cmd.AddCommand(
+		newImageDiffCmd(opts, streams),
+		newImageInspectCmd(opts, streams),
+		newImageListCmd(opts, streams),
+	)
+	return cmd
+}
@@ -0,0 +1,181 @@
+package image
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"github.com/containerd/containerd/platforms"
+	"github.com/spf13/cobra"
+	"github.com/warm-metal/kubectl-dev/pkg/cmd/opts"
+	"io"
+	"k8s.io/apimachinery/pkg/api/resource"
+	"k8s.io/cli-runtime/pkg/genericclioptions"
+	"k8s.io/cli-runtime/pkg/printers"
+	"sort"
+	"strings"
+)
+
+type imageInspectOptions struct {
+	*opts.GlobalOptions
+	genericclioptions.IOStreams
+
+	source imageSource
+	output string
+
+	ref string
+}
+
+func (o *imageInspectOptions) Complete(cmd *cobra.Command, args []string) error {
+	if len(args) != 1 {
+		cmd.SilenceUsage = false
+		return fmt.Errorf("an image is required")
+	}
+
+	o.ref = args[0]
+	return nil
+}
+
+func (o *imageInspectOptions) Validate() error {
+	return validateOutput(o.output)
+}
+
+func (o *imageInspectOptions) Run(ctx context.Context) error {
+	if err := o.source.open(ctx, o.GlobalOptions, o.ErrOut); err != nil {
+		return err
+	}
+
+	defer o.source.close()
+	img, err := o.source.fetch(ctx, o.ref)
+	if err != nil {
+		return err
+	}
+
+	if o.output == "json" {
+		return printJSON(o.Out, map[string]interface{}{
+			"name":     img.Name,
+			"digest":   img.Digest,
+			"platform": platforms.Format(img.Platform),
+			"manifest": img.Manifest,
+			"config":   img.Config,
+		})
+	}
+
+	w := printers.GetNewTabWriter(o.Out)
+	defer w.Flush()
+
+	config := &img.Config.Config
+	fmt.Fprintf(w, "Name:\t%s\n", img.Name)
+	fmt.Fprintf(w, "Digest:\t%s\n", img.Digest)
+	fmt.Fprintf(w, "Platform:\t%s\n", platforms.Format(img.Platform))
+	if img.Config.Created != nil {
+		fmt.Fprintf(w, "Created:\t%s\n", img.Config.Created)
+	}
+
+	fmt.Fprintf(w, "Size:\t%s\n", formatSize(img.Size()))
+	fmt.Fprintf(w, "Entrypoint:\t%s\n", strings.Join(config.Entrypoint, " "))
+	fmt.Fprintf(w, "Cmd:\t%s\n", strings.Join(config.Cmd, " "))
+	fmt.Fprintf(w, "User:\t%s\n", config.User)
+	fmt.Fprintf(w, "WorkingDir:\t%s\n", config.WorkingDir)
+	fmt.Fprintf(w, "ExposedPorts:\t%s\n", strings.Join(sortedKeys(config.ExposedPorts), ", "))
+	fmt.Fprintf(w, "Volumes:\t%s\n", strings.Join(sortedKeys(config.Volumes), ", "))
+	fmt.Fprintln(w, "Env:")
+	for _, env := range config.Env {
+		fmt.Fprintf(w, "  %s\n", env)
+	}
+
+	fmt.Fprintln(w, "Labels:")
+	labels := make([]string, 0, len(config.Labels))
+	for k, v := range config.Labels {
+		labels = append(labels, fmt.Sprintf("  %s=%s", k, v))
+	}
+
+	sort.Strings(labels)
+	for _, label := range labels {
+		fmt.Fprintln(w, label)
+	}
+
+	fmt.Fprintln(w, "\nLAYER\tDIGEST\tSIZE\tMEDIA TYPE")
+	for i, layer := range img.Manifest.Layers {
+		fmt.Fprintf(w, "%d\t%s\t%s\t%s\n", i, layer.Digest, formatSize(layer.Size), layer.MediaType)
+	}
+
+	fmt.Fprintln(w, "\nCREATED\tCREATED BY\tEMPTY LAYER\tCOMMENT")
+	for _, history := range img.Config.History {
+		created := ""
+		if history.Created != nil {
+			created = history.Created.Format("2006-01-02 15:04:05")
+		}
+
+		fmt.Fprintf(w, "%s\t%s\t%t\t%s\n", created, strings.TrimSpace(history.CreatedBy), history.EmptyLayer,
+			history.Comment)
+	}
+
+	return nil
+}
+
+func validateOutput(output string) error {
+	switch output {
+	case "", "json":
+		return nil
+	default:
+		return fmt.Errorf("output format must be json if set")
+	}
+}
+
+func printJSON(out io.Writer, v interface{}) error {
+	encoder := json.NewEncoder(out)
+	encoder.SetIndent("", "  ")
+	return encoder.Encode(v)
+}
+
+func formatSize(size int64) string {
+	return resource.NewQuantity(size, resource.BinarySI).String()
+}
+
+func sortedKeys(set map[string]struct{}) []string {
+	keys := make([]string, 0, len(set))
+	for k := range set {
+		keys = append(keys, k)
+	}
+
+	sort.Strings(keys)
+	return keys
+}
+
+func newImageInspectCmd(opts *opts.GlobalOptions, streams genericclioptions.IOStreams) *cobra.Command {
+	o := &imageInspectOptions{
+		GlobalOptions: opts,
+		IOStreams:     streams,
+	}
+
+	var cmd = &cobra.Command{
+		Use:   "inspect [OPTIONS] image",
+		Short: "Show config, layers and history of an image.",
+		Long:  `Show config, layers and history of an image without pulling its layers.`,
+		Example: `# Show the entrypoint, environment variables, layers and history of an image.
+kubectl dev image inspect foo:latest
+
+# Print the raw manifest and config in JSON.
+kubectl dev image inspect foo:latest -o json
+`,
+		SilenceUsage: true,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			if err := o.Complete(cmd, args); err != nil {
+				return err
+			}
+			if err := o.Validate(); err != nil {
+				return err
+			}
+			if err := o.Run(cmd.Context()); err != nil {
+				return err
+			}
+
+			return nil
+		},
+	}
+
+	o.source.addFlags(cmd.Flags())
+	cmd.Flags().StringVarP(&o.output, "output", "o", "", "Output format. Only json is supported.")
+	o.AddPersistentFlags(cmd.Flags())
+	return cmd
+}
@@ -0,0 +1,144 @@
+package image
+
+import (
+	"context"
+	"fmt"
+	"github.com/spf13/cobra"
+	"github.com/warm-metal/kubectl-dev/pkg/cmd/opts"
+	"github.com/warm-metal/kubectl-dev/pkg/image"
+	"k8s.io/cli-runtime/pkg/genericclioptions"
+	"k8s.io/cli-runtime/pkg/printers"
+	"path"
+	"strings"
+)
+
+type imageListOptions struct {
+	*opts.GlobalOptions
+	genericclioptions.IOStreams
+
+	source     imageSource
+	output     string
+	recursive  bool
+	withDigest bool
+
+	ref  string
+	path string
+}
+
+func (o *imageListOptions) Complete(cmd *cobra.Command, args []string) error {
+	if len(args) == 0 || len(args) > 2 {
+		cmd.SilenceUsage = false
+		return fmt.Errorf("an image and an optional path are required")
+	}
+
+	o.ref = args[0]
+	o.path = "/"
+	if len(args) > 1 {
+		o.path = path.Clean("/" + args[1])
+	}
+
+	return nil
+}
+
+func (o *imageListOptions) Validate() error {
+	return validateOutput(o.output)
+}
+
+func (o *imageListOptions) Run(ctx context.Context) error {
+	if err := o.source.open(ctx, o.GlobalOptions, o.ErrOut); err != nil {
+		return err
+	}
+
+	defer o.source.close()
+	img, err := o.source.fetch(ctx, o.ref)
+	if err != nil {
+		return err
+	}
+
+	tree, err := o.source.readFileTree(ctx, img, o.path, o.withDigest)
+	if err != nil {
+		return err
+	}
+
+	if len(tree) == 0 {
+		return fmt.Errorf("%s not found in image %s", o.path, o.ref)
+	}
+
+	var files []*image.File
+	for _, file := range tree.Sorted() {
+		// Only list the path itself and its direct children unless recursive.
+		if o.recursive || file.Path == o.path || path.Dir(file.Path) == o.path {
+			files = append(files, file)
+		}
+	}
+
+	if o.output == "json" {
+		return printJSON(o.Out, files)
+	}
+
+	w := printers.GetNewTabWriter(o.Out)
+	defer w.Flush()
+	header := "MODE\tUID\tGID\tSIZE\tLAYER\tPATH"
+	if o.withDigest {
+		header += "\tDIGEST"
+	}
+
+	fmt.Fprintln(w, header)
+	for _, file := range files {
+		name := file.Path
+		if len(file.Linkname) > 0 {
+			name += " -> " + file.Linkname
+		}
+
+		columns := []string{file.Mode.String(), fmt.Sprint(file.UID), fmt.Sprint(file.GID),
+			formatSize(file.Size), fmt.Sprint(file.Layer), name}
+		if o.withDigest {
+			columns = append(columns, file.Digest)
+		}
+
+		fmt.Fprintln(w, strings.Join(columns, "\t"))
+	}
+
+	return nil
+}
+
+func newImageListCmd(opts *opts.GlobalOptions, streams genericclioptions.IOStreams) *cobra.Command {
+	o := &imageListOptions{
+		GlobalOptions: opts,
+		IOStreams:     streams,
+	}
+
+	var cmd = &cobra.Command{
+		Use:   "ls [OPTIONS] image [path]",
+		Short: "List files in an image.",
+		Long: `List files in the merged file tree of an image without starting a debugger.
+The root directory is listed if the path is omitted.`,
+		Example: `# Check whether a file is in the image.
+kubectl dev image ls foo:latest /etc/foo/foo.yaml
+
+# List all files under /etc recursively in JSON.
+kubectl dev image ls foo:latest /etc -R -o json
+`,
+		SilenceUsage: true,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			if err := o.Complete(cmd, args); err != nil {
+				return err
+			}
+			if err := o.Validate(); err != nil {
+				return err
+			}
+			if err := o.Run(cmd.Context()); err != nil {
+				return err
+			}
+
+			return nil
+		},
+	}
+
+	o.source.addFlags(cmd.Flags())
+	cmd.Flags().StringVarP(&o.output, "output", "o", "", "Output format. Only json is supported.")
+	cmd.Flags().BoolVarP(&o.recursive, "recursive", "R", false, "List subdirectories recursively.")
+	cmd.Flags().BoolVar(&o.withDigest, "digest", false, "Show sha256 digests of regular files.")
+	o.AddPersistentFlags(cmd.Flags())
+	return cmd
+}
@@ -0,0 +1,84 @@
+package image
+
+import (
+	"context"
+	"fmt"
+	"github.com/containerd/containerd/remotes"
+	"github.com/spf13/pflag"
+	"github.com/warm-metal/kubectl-dev/pkg/cmd/opts"
+	"github.com/warm-metal/kubectl-dev/pkg/image"
+	"io"
+)
+
+// imageSource decides where images are read. Images are read in the containerd on the node running buildkitd by
+// default, and from their registries only if --registry is set.
+type imageSource struct {
+	platform string
+	registry bool
+
+	resolver remotes.Resolver
+	cluster  *image.ClusterResolver
+}
+
+func (s *imageSource) addFlags(flags *pflag.FlagSet) {
+	flags.StringVar(&s.platform, "platform", "",
+		"Platform of images. The platform of the node running buildkitd is used if not set.")
+	flags.BoolVar(&s.registry, "registry", false,
+		`Fetch images from their registries using credentials saved by "kubectl dev login", `+
+			"instead of from the cluster.")
+}
+
+func (s *imageSource) open(ctx context.Context, o *opts.GlobalOptions, errOut io.Writer) error {
+	if s.registry {
+		s.resolver = image.NewResolver(errOut)
+		if len(s.platform) > 0 {
+			return nil
+		}
+
+		platform, err := image.ClusterPlatform(ctx, o.ConfigFlags)
+		if err != nil {
+			return fmt.Errorf("unable to detect the platform of the cluster: %s. Specify it via --platform", err)
+		}
+
+		s.platform = platform
+		return nil
+	}
+
+	cluster, err := image.NewClusterResolver(ctx, o.ConfigFlags)
+	if err != nil {
+		return fmt.Errorf("%s. Use --registry to fetch images from their registries", err)
+	}
+
+	fmt.Fprintf(errOut, "Reading images in containerd on node %s\n", cluster.Node)
+	s.resolver, s.cluster = cluster, cluster
+	if len(s.platform) == 0 {
+		s.platform = cluster.Platform
+	}
+
+	return nil
+}
+
+func (s *imageSource) fetch(ctx context.Context, ref string) (*image.Image, error) {
+	img, err := image.Fetch(ctx, s.resolver, ref, s.platform)
+	if err != nil && s.cluster != nil {
+		return nil, fmt.Errorf("%s. Use --registry to fetch it from its registry", err)
+	}
+
+	return img, err
+}
+
+func (s *imageSource) close() {
+	if s.cluster != nil {
+		s.cluster.Close()
+	}
+}
+
+func (s *imageSource) readFileTree(ctx context.Context, img *image.Image, root string, withDigest bool) (
+	image.FileTree, error) {
+	tree, err := image.ReadFileTree(ctx, img, root, withDigest)
+	if err != nil && s.cluster != nil {
+		return nil, fmt.Errorf("%s. Use --registry to fetch its layers from its registry", err)
+	}
+
+	return tree, err
+}
@@ -8,7 +8,6 @@ import (
 	appcorev1 "github.com/warm-metal/cliapp/pkg/apis/cliapp/v1"
 	configv1 "github.com/warm-metal/cliapp/pkg/apis/config/v1"
 	"github.com/warm-metal/kubectl-dev/pkg/cmd/opts"
-	"github.com/warm-metal/kubectl-dev/pkg/kubectl"
 	"github.com/warm-metal/kubectl-dev/pkg/utils"
 	"io"
 	"io/ioutil"
@@ -120,11 +119,11 @@ func (o *PrepareOptions) Validate() error {
 
 func (o *PrepareOptions) Run(ctx context.Context) error {
 	if len(o.manifestURL) > 0 {
-		if err := kubectl.ApplyManifests(o.manifestURL); err != nil {
+		if err := o.ApplyManifests(o.manifestURL); err != nil {
 			return err
 		}
 	} else {
-		if err := kubectl.ApplyManifestsFromStdin(o.manifestReader); err != nil {
+		if err := o.ApplyManifestsFromStdin(o.manifestReader); err != nil {
 			return err
 		}
 	}
@@ -0,0 +1,95 @@
+package cmd
+
+import (
+	"context"
+	"fmt"
+	"github.com/spf13/cobra"
+	"github.com/warm-metal/kubectl-dev/pkg/session"
+	"github.com/warm-metal/kubectl-dev/pkg/utils"
+	"k8s.io/cli-runtime/pkg/genericclioptions"
+	"os"
+	"time"
+)
+
+type ReplayOptions struct {
+	genericclioptions.IOStreams
+
+	file    string
+	speed   float64
+	maxWait time.Duration
+}
+
+func (o *ReplayOptions) Complete(cmd *cobra.Command, args []string) error {
+	if len(args) != 1 {
+		cmd.SilenceUsage = false
+		return fmt.Errorf("a recorded file is required")
+	}
+
+	o.file = utils.ExpandTilde(args[0])
+	return nil
+}
+
+func (o *ReplayOptions) Validate() error {
+	if o.speed <= 0 {
+		return fmt.Errorf("speed must be positive")
+	}
+
+	return nil
+}
+
+func (o *ReplayOptions) Run(ctx context.Context) error {
+	file, err := os.Open(o.file)
+	if err != nil {
+		return err
+	}
+
+	defer file.Close()
+	header, err := session.Replay(ctx, file, o.Out, o.speed, o.maxWait)
+	if err != nil {
+		return err
+	}
+
+	fmt.Fprintf(o.ErrOut, "\nReplayed %s recorded in a %dx%d terminal\n", o.file, header.Width, header.Height)
+	return nil
+}
+
+func NewCmdReplay(streams genericclioptions.IOStreams) *cobra.Command {
+	o := &ReplayOptions{
+		IOStreams: streams,
+		speed:     1,
+		maxWait:   2 * time.Second,
+	}
+
+	var cmd = &cobra.Command{
+		Use:   "replay [OPTIONS] file",
+		Short: "Replay a recorded session.",
+		Long: `Replay a debug or app session recorded via the "--record" option. The record is an asciicast v2 file
+which can also be played by asciinema.`,
+		Example: `# Record a debug session then replay it.
+kubectl dev debug deploy foo --record foo.cast
+kubectl dev replay foo.cast
+
+# Replay in double speed.
+kubectl dev replay foo.cast --speed 2
+`,
+		SilenceUsage: true,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			if err := o.Complete(cmd, args); err != nil {
+				return err
+			}
+			if err := o.Validate(); err != nil {
+				return err
+			}
+			if err := o.Run(cmd.Context()); err != nil {
+				return err
+			}
+
+			return nil
+		},
+	}
+
+	cmd.Flags().Float64Var(&o.speed, "speed", o.speed, "Playback speed.")
+	cmd.Flags().DurationVar(&o.maxWait, "max-wait", o.maxWait,
+		"Limit idle time between outputs. Set 0 to keep the original timing.")
+	return cmd
+}
@@ -0,0 +1,310 @@
+package diagnose
+
+import (
+	"context"
+	"fmt"
+	"github.com/warm-metal/kubectl-dev/pkg/image"
+	"github.com/warm-metal/kubectl-dev/pkg/utils"
+	"io"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/fields"
+	"k8s.io/client-go/kubernetes"
+	"sort"
+	"strings"
+	"time"
+)
+
+const (
+	previousLogLines  = int64(20)
+	imageProbeTimeout = 30 * time.Second
+)
+
+var imagePullFailures = map[string]bool{
+	"ErrImagePull":      true,
+	"ImagePullBackOff":  true,
+	"InvalidImageName":  true,
+	"ErrImageNeverPull": true,
+}
+
+// Pod prints a summary of abnormal containers in the Pod, including the last termination, image pull errors,
+// missing ConfigMap or Secret references, failed probes, and previous logs. It prints nothing if all containers are
+// healthy. Objects the user is not allowed to read, like events, are reported as unavailable.
+func Pod(ctx context.Context, clientset *kubernetes.Clientset, pod *corev1.Pod, out io.Writer) {
+	abnormal := utils.GetAbnormalContainerStatuses(pod.Status)
+	pending := pod.Status.Phase == corev1.PodPending
+	if len(abnormal) == 0 && !pending {
+		return
+	}
+
+	fmt.Fprintf(out, "Pod %s is %s:\n", pod.Name, pod.Status.Phase)
+	if pending {
+		diagnosePendingPod(ctx, clientset, pod, out)
+	}
+
+	for i := range abnormal {
+		status := &abnormal[i]
+		fmt.Fprintf(out, "  Container %s restarted %d times\n", status.Name, status.RestartCount)
+		if waiting := status.State.Waiting; waiting != nil {
+			fmt.Fprintf(out, "    Waiting: %s %s\n", waiting.Reason, waiting.Message)
+			if imagePullFailures[waiting.Reason] {
+				fmt.Fprintf(out, "    Unable to pull image %s\n", status.Image)
+				ImagePull(ctx, status.Image, out)
+			}
+		}
+
+		if terminated := utils.GetLastTermination(status); terminated != nil {
+			fmt.Fprintf(out, "    Last terminated: %s, exit code %d, at %s\n",
+				terminated.Reason, terminated.ExitCode, terminated.FinishedAt)
+			if terminated.Reason == "OOMKilled" {
+				fmt.Fprintf(out, "    Out of memory. Check the memory limit of the container.\n")
+			}
+
+			if len(terminated.Message) > 0 {
+				fmt.Fprintf(out, "    %s\n", strings.TrimSpace(terminated.Message))
+			}
+		}
+	}
+
+	missing, err := findMissingReferences(ctx, clientset, pod)
+	if err != nil {
+		fmt.Fprintf(out, "  Unable to check ConfigMaps and Secrets: %s\n", err)
+	}
+
+	for _, ref := range missing {
+		fmt.Fprintf(out, "  Missing %s\n", ref)
+	}
+
+	events, err := clientset.CoreV1().Events(pod.Namespace).List(ctx, metav1.ListOptions{
+		FieldSelector: fields.Set{
+			"involvedObject.name": pod.Name,
+			"involvedObject.uid":  string(pod.UID),
+			"reason":              "Unhealthy",
+		}.AsSelector().String(),
+	})
+	if err != nil {
+		fmt.Fprintf(out, "  Events unavailable: %s\n", err)
+	} else {
+		for _, event := range events.Items {
+			fmt.Fprintf(out, "  %s (x%d)\n", strings.TrimSpace(event.Message), event.Count)
+		}
+	}
+
+	for i := range abnormal {
+		status := &abnormal[i]
+		if status.LastTerminationState.Terminated == nil {
+			continue
+		}
+
+		tail := previousLogLines
+		logs, err := clientset.CoreV1().Pods(pod.Namespace).GetLogs(pod.Name, &corev1.PodLogOptions{
+			Container: status.Name,
+			Previous:  true,
+			TailLines: &tail,
+		}).DoRaw(ctx)
+		if err != nil {
+			fmt.Fprintf(out, "  Unable to fetch previous logs of container %s: %s\n", status.Name, err)
+			continue
+		}
+
+		fmt.Fprintf(out, "Previous logs of container %s:\n%s\n", status.Name, logs)
+	}
+}
+
+// findMissingReferences returns non-optional ConfigMaps and Secrets referenced by the Pod but not found.
+func findMissingReferences(ctx context.Context, clientset *kubernetes.Clientset, pod *corev1.Pod) ([]string, error) {
+	configMaps := map[string]bool{}
+	secrets := map[string]bool{}
+	isRequired := func(optional *bool) bool {
+		return optional == nil || !*optional
+	}
+
+	for _, volume := range pod.Spec.Volumes {
+		if volume.ConfigMap != nil && isRequired(volume.ConfigMap.Optional) {
+			configMaps[volume.ConfigMap.Name] = true
+		}
+
+		if volume.Secret != nil && isRequired(volume.Secret.Optional) {
+			secrets[volume.Secret.SecretName] = true
+		}
+
+		if volume.Projected == nil {
+			continue
+		}
+
+		for _, source := range volume.Projected.Sources {
+			if source.ConfigMap != nil && isRequired(source.ConfigMap.Optional) {
+				configMaps[source.ConfigMap.Name] = true
+			}
+
+			if source.Secret != nil && isRequired(source.Secret.Optional) {
+				secrets[source.Secret.Name] = true
+			}
+		}
+	}
+
+	for _, containers := range [][]corev1.Container{pod.Spec.InitContainers, pod.Spec.Containers} {
+		for _, c := range containers {
+			for _, env := range c.EnvFrom {
+				if env.ConfigMapRef != nil && isRequired(env.ConfigMapRef.Optional) {
+					configMaps[env.ConfigMapRef.Name] = true
+				}
+
+				if env.SecretRef != nil && isRequired(env.SecretRef.Optional) {
+					secrets[env.SecretRef.Name] = true
+				}
+			}
+
+			for _, env := range c.Env {
+				if env.ValueFrom == nil {
+					continue
+				}
+
+				if ref := env.ValueFrom.ConfigMapKeyRef; ref != nil && isRequired(ref.Optional) {
+					configMaps[ref.Name] = true
+				}
+
+				if ref := env.ValueFrom.SecretKeyRef; ref != nil && isRequired(ref.Optional) {
+					secrets[ref.Name] = true
+				}
+			}
+		}
+	}
+
+	var missing []string
+	for name := range configMaps {
+		_, err := clientset.CoreV1().ConfigMaps(pod.Namespace).Get(ctx, name, metav1.GetOptions{})
+		if errors.IsNotFound(err) {
+			missing = append(missing, "ConfigMap "+name)
+			continue
+		}
+
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	for name := range secrets {
+		_, err := clientset.CoreV1().Secrets(pod.Namespace).Get(ctx, name, metav1.GetOptions{})
+		if errors.IsNotFound(err) {
+			missing = append(missing, "Secret "+name)
+			continue
+		}
+
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	sort.Strings(missing)
+	return missing, nil
+}
+
+// diagnosePendingPod prints why the Pod is not scheduled or started, including scheduler messages, warning events,
+// and PersistentVolumeClaims not bound.
+func diagnosePendingPod(ctx context.Context, clientset *kubernetes.Clientset, pod *corev1.Pod, out io.Writer) {
+	if _, cond := utils.GetPodCondition(&pod.Status, corev1.PodScheduled); cond != nil &&
+		cond.Status != corev1.ConditionTrue {
+		fmt.Fprintf(out, "  Not scheduled: %s %s\n", cond.Reason, strings.TrimSpace(cond.Message))
+	}
+
+	events, err := clientset.CoreV1().Events(pod.Namespace).List(ctx, metav1.ListOptions{
+		FieldSelector: fields.Set{
+			"involvedObject.name": pod.Name,
+			"involvedObject.uid":  string(pod.UID),
+			"type":                corev1.EventTypeWarning,
+		}.AsSelector().String(),
+	})
+	if err != nil {
+		fmt.Fprintf(out, "  Events unavailable: %s\n", err)
+	} else {
+		for _, event := range events.Items {
+			// Failed probes are printed along with abnormal containers.
+			if event.Reason == "Unhealthy" {
+				continue
+			}
+
+			fmt.Fprintf(out, "  %s: %s (x%d)\n", event.Reason, strings.TrimSpace(event.Message), event.Count)
+		}
+	}
+
+	for _, volume := range pod.Spec.Volumes {
+		var claim string
+		switch {
+		case volume.PersistentVolumeClaim != nil:
+			claim = volume.PersistentVolumeClaim.ClaimName
+		case volume.Ephemeral != nil:
+			claim = pod.Name + "-" + volume.Name
+		default:
+			continue
+		}
+
+		diagnoseClaim(ctx, clientset, pod.Namespace, claim, out)
+	}
+}
+
+// diagnoseClaim prints the status and warning events of the PersistentVolumeClaim if it is not bound.
+func diagnoseClaim(ctx context.Context, clientset *kubernetes.Clientset, namespace, name string, out io.Writer) {
+	pvc, err := clientset.CoreV1().PersistentVolumeClaims(namespace).Get(ctx, name, metav1.GetOptions{})
+	if errors.IsNotFound(err) {
+		fmt.Fprintf(out, "  Missing PersistentVolumeClaim %s\n", name)
+		return
+	}
+
+	if err != nil {
+		fmt.Fprintf(out, "  Unable to check PersistentVolumeClaim %s: %s\n", name, err)
+		return
+	}
+
+	if pvc.Status.Phase == corev1.ClaimBound {
+		return
+	}
+
+	storageClass := "<default>"
+	if pvc.Spec.StorageClassName != nil {
+		storageClass = *pvc.Spec.StorageClassName
+	}
+
+	fmt.Fprintf(out, "  PersistentVolumeClaim %s is %s, storage class %s\n", name, pvc.Status.Phase, storageClass)
+	events, err := clientset.CoreV1().Events(namespace).List(ctx, metav1.ListOptions{
+		FieldSelector: fields.Set{
+			"involvedObject.name": pvc.Name,
+			"involvedObject.uid":  string(pvc.UID),
+			"type":                corev1.EventTypeWarning,
+		}.AsSelector().String(),
+	})
+	if err != nil {
+		fmt.Fprintf(out, "    Events unavailable: %s\n", err)
+		return
+	}
+
+	for _, event := range events.Items {
+		fmt.Fprintf(out, "    %s: %s (x%d)\n", event.Reason, strings.TrimSpace(event.Message), event.Count)
+	}
+}
+
+// ImagePull resolves the image locally via credentials saved by "kubectl dev login", then tells whether the
+// failure is about authorization, a missing image or the network.
+func ImagePull(ctx context.Context, ref string, out io.Writer) {
+	ctx, cancel := context.WithTimeout(ctx, imageProbeTimeout)
+	defer cancel()
+
+	_, desc, err := image.Resolve(ctx, image.NewResolver(out), ref)
+	if err == nil {
+		fmt.Fprintf(out, "    Image %s can be pulled using local credentials, digest %s. "+
+			"Check imagePullSecrets of the Pod and whether the node can reach the registry.\n", ref, desc.Digest)
+		return
+	}
+
+	reason := image.GetPullErrorReason(err)
+	fmt.Fprintf(out, "    Resolving %s locally failed, %s: %s\n", ref, reason, err)
+	switch reason {
+	case image.PullErrorAuth:
+		fmt.Fprintf(out, "    Run \"kubectl dev login\" for the registry and check imagePullSecrets of the Pod.\n")
+	case image.PullErrorNotFound:
+		fmt.Fprintf(out, "    Check whether the repository and tag exist.\n")
+	case image.PullErrorNetwork:
+		fmt.Fprintf(out, "    Check whether the registry is reachable and its certificate is trusted.\n")
+	}
+}
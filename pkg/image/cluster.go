@@ -0,0 +1,143 @@
+package image
+
+import (
+	"context"
+	"fmt"
+	"github.com/containerd/containerd/platforms"
+	"github.com/warm-metal/kubectl-dev/pkg/kubectl"
+	"github.com/warm-metal/kubectl-dev/pkg/utils"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/credentials/insecure"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes"
+	"net"
+)
+
+const (
+	builderNamespace = "cliapp-system"
+	builderWorkload  = "deploy/buildkitd"
+	builderContainer = "buildkitd"
+
+	// containerdAddr is the containerd socket mounted in the buildkitd Pod.
+	containerdAddr = "unix:///run/containerd/containerd.sock"
+)
+
+// ClusterResolver resolves and fetches images in the containerd on the node running buildkitd. It has images built by
+// "kubectl dev build" and images of Pods on the node, including those in registries only nodes can reach.
+// The containerd socket is connected through "buildctl dial-stdio" in the buildkitd Pod.
+type ClusterResolver struct {
+	*containerdResolver
+
+	// Node is the node running buildkitd, and Platform is its platform.
+	Node     string
+	Platform string
+
+	conn *grpc.ClientConn
+}
+
+// NewClusterResolver connects to the containerd on the node running buildkitd.
+func NewClusterResolver(ctx context.Context, flags kubectl.ConfigFlags) (*ClusterResolver, error) {
+	clientset, err := flags.ClientSet()
+	if err != nil {
+		return nil, err
+	}
+
+	pod, err := findBuilderPod(ctx, flags, clientset)
+	if err != nil {
+		return nil, err
+	}
+
+	node, err := clientset.CoreV1().Nodes().Get(ctx, pod.Spec.NodeName, metav1.GetOptions{})
+	if err != nil {
+		return nil, err
+	}
+
+	dialer := func(context.Context, string) (net.Conn, error) {
+		return flags.DialExec(pod.Name, pod.Namespace, builderContainer,
+			[]string{"buildctl", "--addr", containerdAddr, "dial-stdio"})
+	}
+
+	conn, err := grpc.DialContext(ctx, "containerd", grpc.WithContextDialer(dialer),
+		grpc.WithTransportCredentials(insecure.NewCredentials()))
+	if err != nil {
+		return nil, fmt.Errorf("unable to connect to containerd on node %s: %s", node.Name, err)
+	}
+
+	platform, err := nodePlatform(node)
+	if err != nil {
+		conn.Close()
+		return nil, err
+	}
+
+	return &ClusterResolver{
+		containerdResolver: newContainerdResolver(conn),
+		Node:               node.Name,
+		Platform:           platform,
+		conn:               conn,
+	}, nil
+}
+
+func (r *ClusterResolver) Close() error {
+	return r.conn.Close()
+}
+
+// ClusterPlatform returns the platform of the node running buildkitd, or of any node if buildkitd is not installed.
+func ClusterPlatform(ctx context.Context, flags kubectl.ConfigFlags) (string, error) {
+	clientset, err := flags.ClientSet()
+	if err != nil {
+		return "", err
+	}
+
+	if pod, err := findBuilderPod(ctx, flags, clientset); err == nil {
+		node, err := clientset.CoreV1().Nodes().Get(ctx, pod.Spec.NodeName, metav1.GetOptions{})
+		if err != nil {
+			return "", err
+		}
+
+		return nodePlatform(node)
+	}
+
+	nodes, err := clientset.CoreV1().Nodes().List(ctx, metav1.ListOptions{Limit: 1})
+	if err != nil {
+		return "", err
+	}
+
+	if len(nodes.Items) == 0 {
+		return "", fmt.Errorf("no node found in the cluster")
+	}
+
+	return nodePlatform(&nodes.Items[0])
+}
+
+func findBuilderPod(ctx context.Context, flags kubectl.ConfigFlags, clientset kubernetes.Interface) (*corev1.Pod, error) {
+	workload, err := utils.FetchWorkload(flags.Raw(), builderNamespace, builderWorkload)
+	if err != nil {
+		return nil, err
+	}
+
+	pods, err := workload.ListPods(ctx, clientset)
+	if err != nil {
+		return nil, err
+	}
+
+	for i := range pods {
+		if pods[i].Status.Phase == corev1.PodRunning && utils.IsPodReady(&pods[i]) {
+			return &pods[i], nil
+		}
+	}
+
+	return nil, fmt.Errorf(`buildkitd is not running in namespace %s. Run "kubectl dev prepare" to install it`,
+		builderNamespace)
+}
+
+// nodePlatform returns the platform of the node, e.g., "linux/arm64".
+func nodePlatform(node *corev1.Node) (string, error) {
+	info := &node.Status.NodeInfo
+	platform, err := platforms.Parse(info.OperatingSystem + "/" + info.Architecture)
+	if err != nil {
+		return "", fmt.Errorf("unknown platform of node %s: %s", node.Name, err)
+	}
+
+	return platforms.Format(platform), nil
+}
@@ -0,0 +1,140 @@
+package image
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	contentapi "github.com/containerd/containerd/api/services/content/v1"
+	imagesapi "github.com/containerd/containerd/api/services/images/v1"
+	"github.com/containerd/containerd/content"
+	"github.com/containerd/containerd/content/proxy"
+	"github.com/containerd/containerd/errdefs"
+	"github.com/containerd/containerd/images"
+	"github.com/containerd/containerd/namespaces"
+	"github.com/containerd/containerd/remotes"
+	"github.com/docker/distribution/reference"
+	ocispec "github.com/opencontainers/image-spec/specs-go/v1"
+	"google.golang.org/grpc"
+	"io"
+	"io/ioutil"
+)
+
+// containerdNamespace is the containerd namespace where images of Pods and images built by buildkitd are stored.
+const containerdNamespace = "k8s.io"
+
+// containerdResolver resolves and fetches images stored in containerd. Images are never pulled.
+type containerdResolver struct {
+	images  imagesapi.ImagesClient
+	content content.Store
+}
+
+// newContainerdResolver returns a resolver which reads images in the containerd connected via conn.
+func newContainerdResolver(conn *grpc.ClientConn) *containerdResolver {
+	return &containerdResolver{
+		images:  imagesapi.NewImagesClient(conn),
+		content: proxy.NewContentStore(contentapi.NewContentClient(conn)),
+	}
+}
+
+// Resolve finds the image by its name. Images pulled by tags can also be found by digests, as long as the manifest
+// or the index is in the content store.
+func (r *containerdResolver) Resolve(ctx context.Context, ref string) (string, ocispec.Descriptor, error) {
+	named, err := reference.ParseDockerRef(ref)
+	if err != nil {
+		return "", ocispec.Descriptor{}, err
+	}
+
+	// Images are named in the normalized form in containerd, e.g., docker.io/library/foo:latest.
+	ctx = namespaces.WithNamespace(ctx, containerdNamespace)
+	resp, err := r.images.Get(ctx, &imagesapi.GetImageRequest{Name: named.String()})
+	if err == nil {
+		target := resp.Image.Target
+		return named.String(), ocispec.Descriptor{
+			MediaType:   target.MediaType,
+			Digest:      target.Digest,
+			Size:        target.Size_,
+			Annotations: target.Annotations,
+		}, nil
+	}
+
+	if err = errdefs.FromGRPC(err); !errdefs.IsNotFound(err) {
+		return "", ocispec.Descriptor{}, err
+	}
+
+	canonical, ok := named.(reference.Canonical)
+	if !ok {
+		return "", ocispec.Descriptor{}, fmt.Errorf("image %s not found in the cluster: %s", ref, err)
+	}
+
+	info, err := r.content.Info(ctx, canonical.Digest())
+	if err != nil {
+		return "", ocispec.Descriptor{}, fmt.Errorf("image %s not found in the cluster: %s", ref, errdefs.FromGRPC(err))
+	}
+
+	desc := ocispec.Descriptor{Digest: info.Digest, Size: info.Size}
+	if desc.MediaType, err = r.detectMediaType(ctx, desc); err != nil {
+		return "", ocispec.Descriptor{}, err
+	}
+
+	return named.String(), desc, nil
+}
+
+// detectMediaType reads the manifest or the index to find out its media type, which isn't kept in the content store.
+func (r *containerdResolver) detectMediaType(ctx context.Context, desc ocispec.Descriptor) (string, error) {
+	ra, err := r.content.ReaderAt(ctx, desc)
+	if err != nil {
+		return "", errdefs.FromGRPC(err)
+	}
+
+	defer ra.Close()
+	b, err := ioutil.ReadAll(io.LimitReader(content.NewReader(ra), maxMetadataSize))
+	if err != nil {
+		return "", err
+	}
+
+	var manifest struct {
+		MediaType string            `json:"mediaType"`
+		Manifests []json.RawMessage `json:"manifests"`
+		Layers    []json.RawMessage `json:"layers"`
+	}
+
+	if err = json.Unmarshal(b, &manifest); err != nil {
+		return "", fmt.Errorf("%s is neither a manifest nor an index: %s", desc.Digest, err)
+	}
+
+	switch {
+	case len(manifest.MediaType) > 0:
+		return manifest.MediaType, nil
+	case manifest.Manifests != nil:
+		return ocispec.MediaTypeImageIndex, nil
+	case manifest.Layers != nil:
+		return ocispec.MediaTypeImageManifest, nil
+	default:
+		return "", fmt.Errorf("%s is neither a manifest nor an index", desc.Digest)
+	}
+}
+
+func (r *containerdResolver) Fetcher(ctx context.Context, ref string) (remotes.Fetcher, error) {
+	return remotes.FetcherFunc(func(ctx context.Context, desc ocispec.Descriptor) (io.ReadCloser, error) {
+		ctx = namespaces.WithNamespace(ctx, containerdNamespace)
+		ra, err := r.content.ReaderAt(ctx, desc)
+		if err != nil {
+			err = errdefs.FromGRPC(err)
+			if errdefs.IsNotFound(err) && images.IsLayerType(desc.MediaType) {
+				// Nodes may discard compressed layers once unpacked.
+				return nil, fmt.Errorf("layer %s isn't kept in the cluster: %s", desc.Digest, err)
+			}
+
+			return nil, err
+		}
+
+		return struct {
+			io.Reader
+			io.Closer
+		}{content.NewReader(ra), ra}, nil
+	}), nil
+}
+
+func (r *containerdResolver) Pusher(ctx context.Context, ref string) (remotes.Pusher, error) {
+	return nil, fmt.Errorf("pushing images to the cluster is not supported")
+}
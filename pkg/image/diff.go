@@ -0,0 +1,176 @@
+package image
+
+import (
+	"fmt"
+	"github.com/containerd/containerd/platforms"
+	ocispec "github.com/opencontainers/image-spec/specs-go/v1"
+	"sort"
+	"strings"
+)
+
+type ChangeKind string
+
+const (
+	ChangeAdded    ChangeKind = "added"
+	ChangeRemoved  ChangeKind = "removed"
+	ChangeModified ChangeKind = "modified"
+)
+
+// FileChange is a difference of a file between two images.
+type FileChange struct {
+	Kind ChangeKind `json:"kind"`
+	Path string     `json:"path"`
+
+	// Descriptions of modifications, e.g., content, mode, owner, and link target.
+	Details []string `json:"details,omitempty"`
+}
+
+// ConfigChange is a difference of a config field between two images. Old or New is empty if the field is added or
+// removed.
+type ConfigChange struct {
+	Field string `json:"field"`
+	Old   string `json:"old,omitempty"`
+	New   string `json:"new,omitempty"`
+}
+
+// DiffFileTrees returns files added, removed or modified in b compared to a, sorted by path.
+func DiffFileTrees(a, b FileTree) []FileChange {
+	var changes []FileChange
+	for p, old := range a {
+		file, found := b[p]
+		if !found {
+			changes = append(changes, FileChange{Kind: ChangeRemoved, Path: p})
+			continue
+		}
+
+		if details := diffFile(old, file); len(details) > 0 {
+			changes = append(changes, FileChange{Kind: ChangeModified, Path: p, Details: details})
+		}
+	}
+
+	for p := range b {
+		if _, found := a[p]; !found {
+			changes = append(changes, FileChange{Kind: ChangeAdded, Path: p})
+		}
+	}
+
+	sort.Slice(changes, func(i, j int) bool {
+		return changes[i].Path < changes[j].Path
+	})
+	return changes
+}
+
+func diffFile(a, b *File) (details []string) {
+	if a.Mode.Type() != b.Mode.Type() {
+		return []string{fmt.Sprintf("type %s -> %s", a.Mode, b.Mode)}
+	}
+
+	if a.Digest != b.Digest || (a.Mode.IsRegular() && a.Size != b.Size) {
+		details = append(details, fmt.Sprintf("content %d -> %d bytes", a.Size, b.Size))
+	}
+
+	if a.Mode.Perm() != b.Mode.Perm() {
+		details = append(details, fmt.Sprintf("mode %s -> %s", a.Mode, b.Mode))
+	}
+
+	if a.UID != b.UID || a.GID != b.GID {
+		details = append(details, fmt.Sprintf("owner %d:%d -> %d:%d", a.UID, a.GID, b.UID, b.GID))
+	}
+
+	if a.Linkname != b.Linkname {
+		details = append(details, fmt.Sprintf("link %s -> %s", a.Linkname, b.Linkname))
+	}
+
+	return
+}
+
+// DiffConfigs returns differences of the platform, entrypoint, command, environment variables, user, working directory,
+// exposed ports, volumes and labels.
+func DiffConfigs(a, b *ocispec.Image) []ConfigChange {
+	var changes []ConfigChange
+	diff := func(field, before, after string) {
+		if before != after {
+			changes = append(changes, ConfigChange{Field: field, Old: before, New: after})
+		}
+	}
+
+	diff("Platform", platforms.Format(ocispec.Platform{OS: a.OS, Architecture: a.Architecture, Variant: a.Variant}),
+		platforms.Format(ocispec.Platform{OS: b.OS, Architecture: b.Architecture, Variant: b.Variant}))
+	diff("Entrypoint", formatArgs(a.Config.Entrypoint), formatArgs(b.Config.Entrypoint))
+	diff("Cmd", formatArgs(a.Config.Cmd), formatArgs(b.Config.Cmd))
+	diff("User", a.Config.User, b.Config.User)
+	diff("WorkingDir", a.Config.WorkingDir, b.Config.WorkingDir)
+	diff("StopSignal", a.Config.StopSignal, b.Config.StopSignal)
+	diff("ExposedPorts", formatSet(a.Config.ExposedPorts), formatSet(b.Config.ExposedPorts))
+	diff("Volumes", formatSet(a.Config.Volumes), formatSet(b.Config.Volumes))
+	changes = append(changes, diffMaps("Env", parseEnv(a.Config.Env), parseEnv(b.Config.Env))...)
+	changes = append(changes, diffMaps("Label", a.Config.Labels, b.Config.Labels)...)
+	return changes
+}
+
+func diffMaps(field string, a, b map[string]string) []ConfigChange {
+	keys := make(map[string]bool, len(a)+len(b))
+	for k := range a {
+		keys[k] = true
+	}
+
+	for k := range b {
+		keys[k] = true
+	}
+
+	sorted := make([]string, 0, len(keys))
+	for k := range keys {
+		sorted = append(sorted, k)
+	}
+
+	sort.Strings(sorted)
+	var changes []ConfigChange
+	for _, k := range sorted {
+		before, inA := a[k]
+		after, inB := b[k]
+		if inA == inB && before == after {
+			continue
+		}
+
+		changes = append(changes, ConfigChange{Field: field + " " + k, Old: before, New: after})
+	}
+
+	return changes
+}
+
+func parseEnv(env []string) map[string]string {
+	vars := make(map[string]string, len(env))
+	for _, e := range env {
+		kv := strings.SplitN(e, "=", 2)
+		if len(kv) == 2 {
+			vars[kv[0]] = kv[1]
+		} else {
+			vars[kv[0]] = ""
+		}
+	}
+
+	return vars
+}
+
+func formatArgs(args []string) string {
+	if len(args) == 0 {
+		return ""
+	}
+
+	quoted := make([]string, len(args))
+	for i, arg := range args {
+		quoted[i] = fmt.Sprintf("%q", arg)
+	}
+
+	return "[" + strings.Join(quoted, ", ") + "]"
+}
+
+func formatSet(set map[string]struct{}) string {
+	keys := make([]string, 0, len(set))
+	for k := range set {
+		keys = append(keys, k)
+	}
+
+	sort.Strings(keys)
+	return strings.Join(keys, ", ")
+}
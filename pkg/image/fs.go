@@ -0,0 +1,131 @@
+package image
+
+import (
+	"archive/tar"
+	"context"
+	"crypto/sha256"
+	"fmt"
+	"io"
+	"os"
+	"path"
+	"sort"
+	"strings"
+)
+
+const (
+	whiteoutPrefix = ".wh."
+	whiteoutOpaque = ".wh..wh..opq"
+)
+
+// File is an entry in the merged file tree of an image.
+type File struct {
+	Path     string      `json:"path"`
+	Mode     os.FileMode `json:"mode"`
+	Size     int64       `json:"size"`
+	UID      int         `json:"uid"`
+	GID      int         `json:"gid"`
+	Linkname string      `json:"linkname,omitempty"`
+	Digest   string      `json:"digest,omitempty"`
+
+	// Index of the layer in which the file is changed at last.
+	Layer int `json:"layer"`
+}
+
+// FileTree maps absolute paths to files in the image.
+type FileTree map[string]*File
+
+// ReadFileTree merges all layers of the image and applies whiteouts. Only files under prefix are returned if it is
+// not empty. If withDigest is true, the sha256 digest of each regular file is calculated.
+func ReadFileTree(ctx context.Context, img *Image, prefix string, withDigest bool) (FileTree, error) {
+	prefix = path.Clean("/" + prefix)
+	under := func(p string) bool {
+		return prefix == "/" || p == prefix || strings.HasPrefix(p, prefix+"/")
+	}
+
+	tree := FileTree{}
+	err := img.WalkLayers(ctx, func(layer int, hdr *tar.Header, r io.Reader) error {
+		p := path.Clean("/" + hdr.Name)
+		dir, base := path.Split(p)
+		switch {
+		case base == whiteoutOpaque:
+			tree.removeChildren(path.Clean(dir), layer)
+			return nil
+		case strings.HasPrefix(base, whiteoutPrefix):
+			tree.remove(path.Join(dir, strings.TrimPrefix(base, whiteoutPrefix)), layer)
+			return nil
+		}
+
+		if !under(p) {
+			// A non-directory replacing an ancestor of the prefix hides all files under it.
+			if hdr.Typeflag != tar.TypeDir && strings.HasPrefix(prefix, p+"/") {
+				tree.removeChildren(p, layer)
+			}
+
+			return nil
+		}
+
+		file := &File{
+			Path:     p,
+			Mode:     hdr.FileInfo().Mode(),
+			Size:     hdr.Size,
+			UID:      hdr.Uid,
+			GID:      hdr.Gid,
+			Linkname: hdr.Linkname,
+			Layer:    layer,
+		}
+
+		if withDigest && hdr.Typeflag == tar.TypeReg {
+			h := sha256.New()
+			if _, err := io.Copy(h, r); err != nil {
+				return err
+			}
+
+			file.Digest = fmt.Sprintf("sha256:%x", h.Sum(nil))
+		}
+
+		// A non-directory replaces the whole subtree.
+		if old, found := tree[p]; found && old.Mode.IsDir() && !file.Mode.IsDir() {
+			tree.removeChildren(p, layer)
+		}
+
+		tree[p] = file
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return tree, nil
+}
+
+// remove deletes the file and its children added by lower layers.
+func (t FileTree) remove(p string, layer int) {
+	if f, found := t[p]; found && f.Layer < layer {
+		delete(t, p)
+	}
+
+	t.removeChildren(p, layer)
+}
+
+// removeChildren deletes children of the directory added by lower layers.
+func (t FileTree) removeChildren(dir string, layer int) {
+	prefix := strings.TrimSuffix(dir, "/") + "/"
+	for p, f := range t {
+		if strings.HasPrefix(p, prefix) && f.Layer < layer {
+			delete(t, p)
+		}
+	}
+}
+
+// Sorted returns all files sorted by path.
+func (t FileTree) Sorted() []*File {
+	files := make([]*File, 0, len(t))
+	for _, f := range t {
+		files = append(files, f)
+	}
+
+	sort.Slice(files, func(i, j int) bool {
+		return files[i].Path < files[j].Path
+	})
+	return files
+}
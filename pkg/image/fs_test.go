@@ -0,0 +1,139 @@
+package image
+
+import (
+	"archive/tar"
+	"bytes"
+	"context"
+	"fmt"
+	"github.com/opencontainers/go-digest"
+	ocispec "github.com/opencontainers/image-spec/specs-go/v1"
+	"io"
+	"io/ioutil"
+	"reflect"
+	"testing"
+)
+
+// layerFetcher serves layers as uncompressed tarballs indexed by their digests.
+type layerFetcher map[digest.Digest][]byte
+
+func (f layerFetcher) Fetch(_ context.Context, desc ocispec.Descriptor) (io.ReadCloser, error) {
+	blob, found := f[desc.Digest]
+	if !found {
+		return nil, fmt.Errorf("layer %s not found", desc.Digest)
+	}
+
+	return ioutil.NopCloser(bytes.NewReader(blob)), nil
+}
+
+// buildImage builds an image with layers. Names ending with "/" are directories, others are regular files.
+func buildImage(t *testing.T, layers ...[]string) *Image {
+	img := &Image{}
+	fetcher := layerFetcher{}
+	for _, names := range layers {
+		var buf bytes.Buffer
+		tw := tar.NewWriter(&buf)
+		for _, name := range names {
+			hdr := &tar.Header{Name: name, Typeflag: tar.TypeReg, Mode: 0644}
+			if name[len(name)-1] == '/' {
+				hdr.Typeflag, hdr.Mode = tar.TypeDir, 0755
+			}
+
+			if err := tw.WriteHeader(hdr); err != nil {
+				t.Fatal(err)
+			}
+		}
+
+		if err := tw.Close(); err != nil {
+			t.Fatal(err)
+		}
+
+		desc := ocispec.Descriptor{MediaType: ocispec.MediaTypeImageLayer, Digest: digest.FromBytes(buf.Bytes())}
+		fetcher[desc.Digest] = buf.Bytes()
+		img.Manifest.Layers = append(img.Manifest.Layers, desc)
+	}
+
+	img.fetcher = fetcher
+	return img
+}
+
+func TestReadFileTree(t *testing.T) {
+	tests := []struct {
+		name   string
+		layers [][]string
+		prefix string
+		want   []string
+	}{
+		{
+			name:   "merge",
+			layers: [][]string{{"etc/", "etc/hosts"}, {"etc/passwd", "bin/"}},
+			want:   []string{"/bin", "/etc", "/etc/hosts", "/etc/passwd"},
+		},
+		{
+			name:   "whiteout file",
+			layers: [][]string{{"etc/", "etc/hosts", "etc/passwd"}, {"etc/.wh.hosts"}},
+			want:   []string{"/etc", "/etc/passwd"},
+		},
+		{
+			name:   "whiteout directory",
+			layers: [][]string{{"etc/", "etc/ssl/", "etc/ssl/cert.pem"}, {"etc/.wh.ssl"}},
+			want:   []string{"/etc"},
+		},
+		{
+			name:   "recreated after whiteout",
+			layers: [][]string{{"etc/", "etc/hosts"}, {"etc/.wh.hosts"}, {"etc/hosts"}},
+			want:   []string{"/etc", "/etc/hosts"},
+		},
+		{
+			name:   "whiteout and recreated in the same layer",
+			layers: [][]string{{"etc/", "etc/hosts"}, {"etc/hosts", "etc/.wh.hosts"}},
+			want:   []string{"/etc", "/etc/hosts"},
+		},
+		{
+			name: "opaque directory",
+			layers: [][]string{
+				{"etc/", "etc/hosts", "etc/ssl/", "etc/ssl/cert.pem"},
+				{"etc/", "etc/.wh..wh..opq", "etc/passwd"},
+			},
+			want: []string{"/etc", "/etc/passwd"},
+		},
+		{
+			name:   "file replaces directory",
+			layers: [][]string{{"etc/", "etc/ssl/", "etc/ssl/cert.pem"}, {"etc/ssl"}},
+			want:   []string{"/etc", "/etc/ssl"},
+		},
+		{
+			name:   "prefix",
+			layers: [][]string{{"etc/", "etc/hosts", "etc/ssl/", "etc/ssl/cert.pem", "bin/"}},
+			prefix: "/etc/ssl",
+			want:   []string{"/etc/ssl", "/etc/ssl/cert.pem"},
+		},
+		{
+			name:   "whiteout of an ancestor of the prefix",
+			layers: [][]string{{"etc/", "etc/ssl/", "etc/ssl/cert.pem"}, {".wh.etc"}},
+			prefix: "etc/ssl",
+		},
+		{
+			name:   "file replaces an ancestor of the prefix",
+			layers: [][]string{{"etc/", "etc/ssl/", "etc/ssl/cert.pem"}, {"etc"}},
+			prefix: "etc/ssl",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			tree, err := ReadFileTree(context.TODO(), buildImage(t, tt.layers...), tt.prefix, false)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			var got []string
+			for _, f := range tree.Sorted() {
+				got = append(got, f.Path)
+			}
+
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("ReadFileTree() = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,158 @@
+package image
+
+import (
+	"archive/tar"
+	"context"
+	"encoding/json"
+	"fmt"
+	"github.com/containerd/containerd/archive/compression"
+	"github.com/containerd/containerd/images"
+	"github.com/containerd/containerd/platforms"
+	"github.com/containerd/containerd/remotes"
+	ocispec "github.com/opencontainers/image-spec/specs-go/v1"
+	"io"
+	"io/ioutil"
+)
+
+// maxMetadataSize limits the size of manifests and configs to read.
+const maxMetadataSize = 8 << 20
+
+// Image is an image resolved for a specific platform.
+type Image struct {
+	Name     string
+	Digest   string
+	Platform ocispec.Platform
+
+	Manifest ocispec.Manifest
+	Config   ocispec.Image
+
+	fetcher remotes.Fetcher
+}
+
+// Fetch resolves the image reference and fetches its manifest and config for the platform.
+// The local platform is used if not specified. Callers working on the cluster should pass the platform of its nodes.
+func Fetch(ctx context.Context, resolver remotes.Resolver, ref, platform string) (*Image, error) {
+	if len(platform) == 0 {
+		platform = platforms.DefaultString()
+	}
+
+	spec, err := platforms.Parse(platform)
+	if err != nil {
+		return nil, err
+	}
+
+	ctx = withQuietLog(ctx)
+	name, desc, err := Resolve(ctx, resolver, ref)
+	if err != nil {
+		return nil, fmt.Errorf("unable to resolve %s: %s", ref, err)
+	}
+
+	fetcher, err := resolver.Fetcher(ctx, name)
+	if err != nil {
+		return nil, err
+	}
+
+	img := &Image{Name: name, Digest: desc.Digest.String(), Platform: spec, fetcher: fetcher}
+	switch desc.MediaType {
+	case images.MediaTypeDockerSchema2ManifestList, ocispec.MediaTypeImageIndex:
+		index := ocispec.Index{}
+		if err = img.fetchJSON(ctx, desc, &index); err != nil {
+			return nil, err
+		}
+
+		matcher := platforms.Only(spec)
+		found := false
+		for _, m := range index.Manifests {
+			if m.Platform != nil && matcher.Match(*m.Platform) {
+				desc, found = m, true
+				break
+			}
+		}
+
+		if !found {
+			return nil, fmt.Errorf("image %s doesn't support platform %s", ref, platform)
+		}
+	case images.MediaTypeDockerSchema2Manifest, ocispec.MediaTypeImageManifest:
+	default:
+		return nil, fmt.Errorf("media type %s of image %s is not supported", desc.MediaType, ref)
+	}
+
+	if err = img.fetchJSON(ctx, desc, &img.Manifest); err != nil {
+		return nil, err
+	}
+
+	if err = img.fetchJSON(ctx, img.Manifest.Config, &img.Config); err != nil {
+		return nil, err
+	}
+
+	return img, nil
+}
+
+func (i *Image) fetchJSON(ctx context.Context, desc ocispec.Descriptor, v interface{}) error {
+	r, err := i.fetcher.Fetch(ctx, desc)
+	if err != nil {
+		return fmt.Errorf("unable to fetch %s: %s", desc.Digest, err)
+	}
+
+	defer r.Close()
+	b, err := ioutil.ReadAll(io.LimitReader(r, maxMetadataSize))
+	if err != nil {
+		return fmt.Errorf("unable to fetch %s: %s", desc.Digest, err)
+	}
+
+	return json.Unmarshal(b, v)
+}
+
+// Size returns the sum of compressed sizes of all layers.
+func (i *Image) Size() (size int64) {
+	for _, layer := range i.Manifest.Layers {
+		size += layer.Size
+	}
+
+	return
+}
+
+// WalkLayers calls fn for each entry of each layer, from the bottom layer to the top one.
+// Content of regular files can be read from r before fn returns.
+func (i *Image) WalkLayers(ctx context.Context, fn func(layer int, hdr *tar.Header, r io.Reader) error) error {
+	ctx = withQuietLog(ctx)
+	for n, desc := range i.Manifest.Layers {
+		if err := i.walkLayer(ctx, n, desc, fn); err != nil {
+			return fmt.Errorf("unable to read layer %s: %s", desc.Digest, err)
+		}
+	}
+
+	return nil
+}
+
+func (i *Image) walkLayer(
+	ctx context.Context, n int, desc ocispec.Descriptor, fn func(layer int, hdr *tar.Header, r io.Reader) error,
+) error {
+	blob, err := i.fetcher.Fetch(ctx, desc)
+	if err != nil {
+		return err
+	}
+
+	defer blob.Close()
+	stream, err := compression.DecompressStream(blob)
+	if err != nil {
+		return err
+	}
+
+	defer stream.Close()
+	tr := tar.NewReader(stream)
+	for {
+		hdr, err := tr.Next()
+		if err == io.EOF {
+			return nil
+		}
+
+		if err != nil {
+			return err
+		}
+
+		if err = fn(n, hdr, tr); err != nil {
+			return err
+		}
+	}
+}
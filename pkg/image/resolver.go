@@ -0,0 +1,156 @@
+package image
+
+import (
+	"context"
+	"crypto/x509"
+	"errors"
+	"fmt"
+	"github.com/containerd/containerd/errdefs"
+	"github.com/containerd/containerd/log"
+	"github.com/containerd/containerd/remotes"
+	"github.com/containerd/containerd/remotes/docker"
+	remoteerrors "github.com/containerd/containerd/remotes/errors"
+	cliconfig "github.com/docker/cli/cli/config"
+	"github.com/docker/distribution/reference"
+	ocispec "github.com/opencontainers/image-spec/specs-go/v1"
+	"github.com/sirupsen/logrus"
+	"io"
+	"net"
+	"net/http"
+	"net/url"
+	"os"
+	"strings"
+)
+
+const dockerIndexServer = "https://index.docker.io/v1/"
+
+// PullErrorReason categorizes failures of resolving or pulling images.
+type PullErrorReason string
+
+const (
+	PullErrorAuth     PullErrorReason = "unauthorized"
+	PullErrorNotFound PullErrorReason = "not found"
+	PullErrorNetwork  PullErrorReason = "network failure"
+	PullErrorUnknown  PullErrorReason = "unknown"
+)
+
+// NewResolver returns a resolver which authenticates via credentials saved by "kubectl dev login" or "docker login".
+func NewResolver(errOut io.Writer) remotes.Resolver {
+	configFile := cliconfig.LoadDefaultConfigFile(errOut)
+	creds := func(host string) (string, string, error) {
+		server := host
+		if host == "registry-1.docker.io" || host == "docker.io" {
+			server = dockerIndexServer
+		}
+
+		auth, err := configFile.GetAuthConfig(server)
+		if err != nil {
+			return "", "", err
+		}
+
+		if len(auth.IdentityToken) > 0 {
+			return "", auth.IdentityToken, nil
+		}
+
+		return auth.Username, auth.Password, nil
+	}
+
+	return docker.NewResolver(docker.ResolverOptions{
+		Hosts: docker.ConfigureDefaultRegistries(
+			docker.WithAuthorizer(docker.NewDockerAuthorizer(docker.WithAuthCreds(creds))),
+		),
+	})
+}
+
+// NormalizeReference returns the fully qualified reference, e.g., "docker.io/library/alpine:latest" for "alpine".
+func NormalizeReference(ref string) (string, error) {
+	named, err := reference.ParseDockerRef(ref)
+	if err != nil {
+		return "", fmt.Errorf("invalid image reference %q: %s", ref, err)
+	}
+
+	return named.String(), nil
+}
+
+// IsDigested returns true if the reference points to a digest, e.g., "alpine@sha256:...".
+func IsDigested(ref string) bool {
+	named, err := reference.ParseDockerRef(ref)
+	if err != nil {
+		return false
+	}
+
+	_, ok := named.(reference.Canonical)
+	return ok
+}
+
+// PinDigest returns the reference to the digest in the repository of the given reference,
+// e.g., "docker.io/library/alpine@sha256:..." for "alpine:3.13".
+func PinDigest(ref, digest string) (string, error) {
+	named, err := reference.ParseDockerRef(ref)
+	if err != nil {
+		return "", fmt.Errorf("invalid image reference %q: %s", ref, err)
+	}
+
+	return reference.TrimNamed(named).String() + "@" + digest, nil
+}
+
+// Resolve normalizes the reference then resolves it to a descriptor.
+func Resolve(ctx context.Context, resolver remotes.Resolver, ref string) (string, ocispec.Descriptor, error) {
+	name, err := NormalizeReference(ref)
+	if err != nil {
+		return "", ocispec.Descriptor{}, err
+	}
+
+	return resolver.Resolve(withQuietLog(ctx), name)
+}
+
+// withQuietLog suppresses info logs of the resolver, like "trying next host". Errors are returned anyway.
+func withQuietLog(ctx context.Context) context.Context {
+	logger := logrus.New()
+	logger.SetOutput(os.Stderr)
+	logger.SetLevel(logrus.WarnLevel)
+	return log.WithLogger(ctx, logrus.NewEntry(logger))
+}
+
+// GetPullErrorReason tells whether the error is caused by authorization, a missing image, or the network.
+func GetPullErrorReason(err error) PullErrorReason {
+	if err == nil {
+		return ""
+	}
+
+	if errors.Is(err, docker.ErrInvalidAuthorization) {
+		return PullErrorAuth
+	}
+
+	var statusErr remoteerrors.ErrUnexpectedStatus
+	if errors.As(err, &statusErr) {
+		switch statusErr.StatusCode {
+		case http.StatusUnauthorized, http.StatusForbidden:
+			return PullErrorAuth
+		case http.StatusNotFound:
+			return PullErrorNotFound
+		}
+	}
+
+	if errdefs.IsNotFound(err) {
+		return PullErrorNotFound
+	}
+
+	var netErr net.Error
+	var urlErr *url.Error
+	var certErr x509.UnknownAuthorityError
+	if errors.As(err, &netErr) || errors.As(err, &urlErr) || errors.As(err, &certErr) {
+		return PullErrorNetwork
+	}
+
+	// The resolver only reports status text in messages if all hosts failed.
+	msg := err.Error()
+	switch {
+	case strings.Contains(msg, "401 Unauthorized"), strings.Contains(msg, "403 Forbidden"):
+		return PullErrorAuth
+	case strings.Contains(msg, "404 Not Found"):
+		return PullErrorNotFound
+	}
+
+	return PullErrorUnknown
+}
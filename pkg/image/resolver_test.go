@@ -0,0 +1,49 @@
+package image
+
+import (
+	"crypto/x509"
+	"errors"
+	"fmt"
+	"github.com/containerd/containerd/errdefs"
+	"github.com/containerd/containerd/remotes/docker"
+	remoteerrors "github.com/containerd/containerd/remotes/errors"
+	"net/http"
+	"net/url"
+	"testing"
+)
+
+func TestGetPullErrorReason(t *testing.T) {
+	tests := []struct {
+		name string
+		err  error
+		want PullErrorReason
+	}{
+		{name: "nil", want: ""},
+		{name: "invalid authorization", err: fmt.Errorf("fetch token: %w", docker.ErrInvalidAuthorization),
+			want: PullErrorAuth},
+		{name: "unauthorized", err: remoteerrors.ErrUnexpectedStatus{StatusCode: http.StatusUnauthorized},
+			want: PullErrorAuth},
+		{name: "wrapped forbidden",
+			err:  fmt.Errorf("resolve: %w", remoteerrors.ErrUnexpectedStatus{StatusCode: http.StatusForbidden}),
+			want: PullErrorAuth},
+		{name: "status not found", err: remoteerrors.ErrUnexpectedStatus{StatusCode: http.StatusNotFound},
+			want: PullErrorNotFound},
+		{name: "not found", err: fmt.Errorf("docker.io/library/none:latest: %w", errdefs.ErrNotFound),
+			want: PullErrorNotFound},
+		{name: "url", err: &url.Error{Op: "Head", URL: "https://registry", Err: errors.New("connection refused")},
+			want: PullErrorNetwork},
+		{name: "certificate", err: fmt.Errorf("tls: %w", x509.UnknownAuthorityError{}), want: PullErrorNetwork},
+		{name: "status text unauthorized", err: errors.New("pulling from host failed with status code: 401 Unauthorized"),
+			want: PullErrorAuth},
+		{name: "status text not found", err: errors.New("unexpected status: 404 Not Found"), want: PullErrorNotFound},
+		{name: "unknown", err: errors.New("invalid manifest"), want: PullErrorUnknown},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := GetPullErrorReason(tt.err); got != tt.want {
+				t.Errorf("GetPullErrorReason() = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
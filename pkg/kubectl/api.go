@@ -1,32 +1,23 @@
 package kubectl
 
-import "io"
+import (
+	"io"
+)
 
-func Exec(pod, namespace, container string, args ...string) error {
-	cmd := []string{
-		"exec", "-ti",
-		"-n", namespace,
-		pod,
-		"-c", container,
-		"--",
-	}
-	return runWithIO(append(cmd, args...))
-}
-
-func ApplyManifests(manifestPath string) error {
-	return run([]string{
+func (o ConfigFlags) ApplyManifests(manifestPath string) error {
+	return o.run([]string{
 		"apply", "--wait", "-f", manifestPath,
-	})
+	}, nil)
 }
 
-func ApplyManifestsFromStdin(stdin io.Reader) error {
-	return run([]string{"apply", "--wait", "-f", "-"}, WithStdin(stdin))
+func (o ConfigFlags) ApplyManifestsFromStdin(stdin io.Reader) error {
+	return o.run([]string{"apply", "--wait", "-f", "-"}, stdin)
 }
 
-func DeleteManifests(manifestsPath string) error {
-	return run([]string{"delete", "--ignore-not-found", "-f", manifestsPath})
+func (o ConfigFlags) DeleteManifests(manifestsPath string) error {
+	return o.run([]string{"delete", "--ignore-not-found", "-f", manifestsPath}, nil)
 }
 
-func Delete(kind, name, namespace string) error {
-	return run([]string{"delete", "--ignore-not-found", "-n", namespace, kind, name})
+func (o ConfigFlags) Delete(kind, name, namespace string) error {
+	return o.run([]string{"delete", "--ignore-not-found", "-n", namespace, kind, name}, nil)
 }
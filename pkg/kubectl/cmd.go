@@ -4,33 +4,32 @@ import (
 	"io"
 	"os"
 	"os/exec"
+	"strings"
 )
 
-type RunOptions func(*exec.Cmd)
+// run executes kubectl with flags pointing to the same cluster and user. Credentials set via flags are passed in a
+// temporary kubeconfig, which is removed once kubectl exits.
+func (o ConfigFlags) run(args []string, stdin io.Reader) error {
+	flags := o.Args()
+	if o.hasCredentials() {
+		kubeconfig, user, err := o.writeCredentials()
+		if err != nil {
+			return err
+		}
 
-func WithStdin(stdin io.Reader) RunOptions {
-	return func(cmd *exec.Cmd) {
-		cmd.Stdin = stdin
-	}
-}
+		defer os.Remove(kubeconfig)
+		var overridden []string
+		for _, flag := range flags {
+			if !strings.HasPrefix(flag, "--kubeconfig=") && !strings.HasPrefix(flag, "--user=") {
+				overridden = append(overridden, flag)
+			}
+		}
 
-func AttachIO() RunOptions {
-	return func(cmd *exec.Cmd) {
-		cmd.Stdin = os.Stdin
-		cmd.Stdout = os.Stdout
-		cmd.Stderr = os.Stderr
+		flags = append(overridden, "--kubeconfig="+kubeconfig, "--user="+user)
 	}
-}
 
-func runWithIO(args []string) error {
-	return run(args, AttachIO())
-}
-
-func run(args []string, opts ...RunOptions) error {
-	cmd := exec.Command("kubectl", args...)
+	cmd := exec.Command("kubectl", append(flags, args...)...)
 	cmd.Env = os.Environ()
-	for _, opt := range opts {
-		opt(cmd)
-	}
+	cmd.Stdin = stdin
 	return cmd.Run()
 }
@@ -0,0 +1,101 @@
+package kubectl
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"net"
+	"strings"
+	"sync"
+	"time"
+)
+
+// DialExec starts the command in the container and returns a connection to it. Data written to the connection are
+// sent to stdin of the command, and its stdout is read from the connection. The connection is closed once the command
+// exits, with its stderr in the error if it fails.
+func (o ConfigFlags) DialExec(pod, namespace, container string, args []string) (net.Conn, error) {
+	stdinReader, stdinWriter := io.Pipe()
+	stdoutReader, stdoutWriter := io.Pipe()
+	stderr := &syncBuffer{}
+	exited := o.StartExec(pod, namespace, container, args,
+		WithStdin(stdinReader), WithStdout(stdoutWriter), WithStderr(stderr))
+	go func() {
+		err := <-exited
+		if err != nil {
+			err = fmt.Errorf("%s: %s", err, strings.TrimSpace(stderr.String()))
+		}
+
+		stdinReader.CloseWithError(io.ErrClosedPipe)
+		stdoutWriter.CloseWithError(err)
+	}()
+
+	return &execConn{stdin: stdinWriter, stdout: stdoutReader, addr: execAddr(namespace + "/" + pod)}, nil
+}
+
+type execConn struct {
+	stdin  *io.PipeWriter
+	stdout *io.PipeReader
+	addr   execAddr
+}
+
+func (c *execConn) Read(b []byte) (int, error) {
+	return c.stdout.Read(b)
+}
+
+func (c *execConn) Write(b []byte) (int, error) {
+	return c.stdin.Write(b)
+}
+
+func (c *execConn) Close() error {
+	c.stdin.Close()
+	return c.stdout.Close()
+}
+
+func (c *execConn) LocalAddr() net.Addr {
+	return c.addr
+}
+
+func (c *execConn) RemoteAddr() net.Addr {
+	return c.addr
+}
+
+// Deadlines are not supported. Connections are closed by closing them or once commands exit.
+func (c *execConn) SetDeadline(t time.Time) error {
+	return nil
+}
+
+func (c *execConn) SetReadDeadline(t time.Time) error {
+	return nil
+}
+
+func (c *execConn) SetWriteDeadline(t time.Time) error {
+	return nil
+}
+
+// execAddr is the Pod in which the command is executed.
+type execAddr string
+
+func (a execAddr) Network() string {
+	return "exec"
+}
+
+func (a execAddr) String() string {
+	return string(a)
+}
+
+type syncBuffer struct {
+	mu  sync.Mutex
+	buf bytes.Buffer
+}
+
+func (b *syncBuffer) Write(p []byte) (int, error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return b.buf.Write(p)
+}
+
+func (b *syncBuffer) String() string {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return b.buf.String()
+}
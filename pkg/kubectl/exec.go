@@ -0,0 +1,145 @@
+package kubectl
+
+import (
+	"fmt"
+	"github.com/moby/term"
+	"golang.org/x/sys/unix"
+	"io"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/client-go/kubernetes"
+	"k8s.io/client-go/kubernetes/scheme"
+	"k8s.io/client-go/tools/remotecommand"
+	"os"
+	"os/signal"
+)
+
+// ExecOption sets streams attached to commands executed in containers.
+type ExecOption func(*remotecommand.StreamOptions)
+
+func WithStdin(stdin io.Reader) ExecOption {
+	return func(opts *remotecommand.StreamOptions) {
+		opts.Stdin = stdin
+	}
+}
+
+func WithStdout(stdout io.Writer) ExecOption {
+	return func(opts *remotecommand.StreamOptions) {
+		opts.Stdout = stdout
+	}
+}
+
+func WithStderr(stderr io.Writer) ExecOption {
+	return func(opts *remotecommand.StreamOptions) {
+		opts.Stderr = stderr
+	}
+}
+
+// RunExec runs a command in the container and waits until it exits. A TTY is allocated if tty is true, in which case
+// the local terminal is put in raw mode and stderr is merged into stdout.
+// Commands are executed through the API server of the cluster the flags point to, the same as "kubectl exec".
+// If the command fails, an exec.CodeExitError is returned with its exit code.
+func (o ConfigFlags) RunExec(pod, namespace, container string, tty bool, args []string, opts ...ExecOption) error {
+	streams := remotecommand.StreamOptions{}
+	for _, opt := range opts {
+		opt(&streams)
+	}
+
+	if tty {
+		streams.Tty = true
+		streams.Stderr = nil
+	}
+
+	config, err := o.configFlags.ToRESTConfig()
+	if err != nil {
+		return fmt.Errorf("invalid kubectl configuration: %s", err)
+	}
+
+	clientset, err := kubernetes.NewForConfig(config)
+	if err != nil {
+		return fmt.Errorf("invalid kubectl configuration: %s", err)
+	}
+
+	req := clientset.CoreV1().RESTClient().Post().
+		Resource("pods").Namespace(namespace).Name(pod).SubResource("exec").
+		VersionedParams(&corev1.PodExecOptions{
+			Container: container,
+			Command:   args,
+			Stdin:     streams.Stdin != nil,
+			Stdout:    streams.Stdout != nil,
+			Stderr:    streams.Stderr != nil,
+			TTY:       tty,
+		}, scheme.ParameterCodec)
+	executor, err := remotecommand.NewSPDYExecutor(config, "POST", req.URL())
+	if err != nil {
+		return err
+	}
+
+	if !tty {
+		return executor.Stream(streams)
+	}
+
+	if inFd, isTerminal := term.GetFdInfo(streams.Stdin); isTerminal {
+		state, err := term.MakeRaw(inFd)
+		if err != nil {
+			return fmt.Errorf("can't initialize terminal: %s", err)
+		}
+
+		defer term.RestoreTerminal(inFd, state)
+	}
+
+	if outFd, isTerminal := term.GetFdInfo(streams.Stdout); isTerminal {
+		sizes := newTerminalSizeQueue(outFd)
+		defer sizes.stop()
+		streams.TerminalSizeQueue = sizes
+	}
+
+	return executor.Stream(streams)
+}
+
+// StartExec starts a command in the container without a TTY and returns immediately.
+// The returned channel receives the result once the command exits.
+func (o ConfigFlags) StartExec(pod, namespace, container string, args []string, opts ...ExecOption) <-chan error {
+	exited := make(chan error, 1)
+	go func() {
+		exited <- o.RunExec(pod, namespace, container, false, args, opts...)
+	}()
+
+	return exited
+}
+
+// terminalSizeQueue sends the size of the local terminal once started and whenever it is resized.
+type terminalSizeQueue struct {
+	fd    uintptr
+	winch chan os.Signal
+	done  chan struct{}
+	sent  bool
+}
+
+func newTerminalSizeQueue(fd uintptr) *terminalSizeQueue {
+	q := &terminalSizeQueue{fd: fd, winch: make(chan os.Signal, 1), done: make(chan struct{})}
+	signal.Notify(q.winch, unix.SIGWINCH)
+	return q
+}
+
+func (q *terminalSizeQueue) Next() *remotecommand.TerminalSize {
+	if q.sent {
+		select {
+		case <-q.winch:
+		case <-q.done:
+			return nil
+		}
+	}
+
+	q.sent = true
+	winsize, err := term.GetWinsize(q.fd)
+	if err != nil {
+		return nil
+	}
+
+	return &remotecommand.TerminalSize{Width: winsize.Width, Height: winsize.Height}
+}
+
+func (q *terminalSizeQueue) stop() {
+	signal.Stop(q.winch)
+	close(q.done)
+}
@@ -3,8 +3,13 @@ package kubectl
 import (
 	"fmt"
 	"github.com/spf13/pflag"
+	"io/ioutil"
 	"k8s.io/cli-runtime/pkg/genericclioptions"
 	"k8s.io/client-go/kubernetes"
+	"k8s.io/client-go/tools/clientcmd"
+	clientcmdapi "k8s.io/client-go/tools/clientcmd/api"
+	"os"
+	"sort"
 )
 
 type ConfigFlags struct {
@@ -38,3 +43,121 @@ func (o *ConfigFlags) AddPersistentFlags(flags *pflag.FlagSet) {
 func (o ConfigFlags) Raw() *genericclioptions.ConfigFlags {
 	return o.configFlags
 }
+
+// Args returns flags of kubectl which are set, such that kubectl subprocesses work on the same cluster.
+// The namespace is excluded since it is specified per command. Credentials are excluded too, otherwise they would be
+// visible in the command line of subprocesses. See writeCredentials.
+func (o ConfigFlags) Args() []string {
+	var args []string
+	for flag, value := range map[string]*string{
+		"kubeconfig":            o.configFlags.KubeConfig,
+		"cluster":               o.configFlags.ClusterName,
+		"user":                  o.configFlags.AuthInfoName,
+		"context":               o.configFlags.Context,
+		"server":                o.configFlags.APIServer,
+		"tls-server-name":       o.configFlags.TLSServerName,
+		"client-certificate":    o.configFlags.CertFile,
+		"client-key":            o.configFlags.KeyFile,
+		"certificate-authority": o.configFlags.CAFile,
+		"as":                    o.configFlags.Impersonate,
+		"as-uid":                o.configFlags.ImpersonateUID,
+		"request-timeout":       o.configFlags.Timeout,
+		"cache-dir":             o.configFlags.CacheDir,
+	} {
+		if value != nil && len(*value) > 0 {
+			args = append(args, "--"+flag+"="+*value)
+		}
+	}
+
+	if o.configFlags.Insecure != nil && *o.configFlags.Insecure {
+		args = append(args, "--insecure-skip-tls-verify")
+	}
+
+	if o.configFlags.ImpersonateGroup != nil {
+		for _, group := range *o.configFlags.ImpersonateGroup {
+			args = append(args, "--as-group="+group)
+		}
+	}
+
+	sort.Strings(args)
+	return args
+}
+
+// hasCredentials tells whether credentials are set via flags.
+func (o ConfigFlags) hasCredentials() bool {
+	for _, value := range []*string{o.configFlags.BearerToken, o.configFlags.Username, o.configFlags.Password} {
+		if value != nil && len(*value) > 0 {
+			return true
+		}
+	}
+
+	return false
+}
+
+// writeCredentials writes the kubeconfig, along with credentials set via flags in the user of the current context, to
+// a temporary file only the current user can read. It returns the file and the user.
+func (o ConfigFlags) writeCredentials() (kubeconfig, user string, err error) {
+	config, err := o.configFlags.ToRawKubeConfigLoader().RawConfig()
+	if err != nil {
+		return "", "", fmt.Errorf("invalid kubectl configuration: %s", err)
+	}
+
+	user = stringValue(o.configFlags.AuthInfoName)
+	if len(user) == 0 {
+		contextName := stringValue(o.configFlags.Context)
+		if len(contextName) == 0 {
+			contextName = config.CurrentContext
+		}
+
+		if context := config.Contexts[contextName]; context != nil {
+			user = context.AuthInfo
+		}
+	}
+
+	if len(user) == 0 {
+		user = "kubectl-dev"
+	}
+
+	authInfo := clientcmdapi.NewAuthInfo()
+	if current := config.AuthInfos[user]; current != nil {
+		authInfo = current.DeepCopy()
+	}
+
+	if token := stringValue(o.configFlags.BearerToken); len(token) > 0 {
+		authInfo.Token = token
+	}
+
+	if username := stringValue(o.configFlags.Username); len(username) > 0 {
+		authInfo.Username = username
+	}
+
+	if password := stringValue(o.configFlags.Password); len(password) > 0 {
+		authInfo.Password = password
+	}
+
+	if config.AuthInfos == nil {
+		config.AuthInfos = map[string]*clientcmdapi.AuthInfo{}
+	}
+
+	config.AuthInfos[user] = authInfo
+	file, err := ioutil.TempFile("", "kubectl-dev-kubeconfig-")
+	if err != nil {
+		return "", "", err
+	}
+
+	file.Close()
+	if err = clientcmd.WriteToFile(config, file.Name()); err != nil {
+		os.Remove(file.Name())
+		return "", "", err
+	}
+
+	return file.Name(), user, nil
+}
+
+func stringValue(s *string) string {
+	if s == nil {
+		return ""
+	}
+
+	return *s
+}
@@ -0,0 +1,276 @@
+package session
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"fmt"
+	rpc "github.com/warm-metal/cliapp/pkg/session"
+	"io"
+	"os"
+	"sync"
+	"time"
+	"unicode/utf8"
+)
+
+const (
+	defaultWidth  = 80
+	defaultHeight = 24
+)
+
+// Header is the first line of an asciicast v2 file.
+type Header struct {
+	Version   int               `json:"version"`
+	Width     uint32            `json:"width"`
+	Height    uint32            `json:"height"`
+	Timestamp int64             `json:"timestamp,omitempty"`
+	Title     string            `json:"title,omitempty"`
+	Env       map[string]string `json:"env,omitempty"`
+}
+
+// Event is an asciicast v2 event. Type is one of "o" for output, "i" for input, and "r" for resize.
+type Event struct {
+	Time float64
+	Type string
+	Data string
+}
+
+func (e Event) MarshalJSON() ([]byte, error) {
+	return json.Marshal([]interface{}{e.Time, e.Type, e.Data})
+}
+
+func (e *Event) UnmarshalJSON(b []byte) error {
+	var fields []interface{}
+	if err := json.Unmarshal(b, &fields); err != nil {
+		return err
+	}
+
+	if len(fields) != 3 {
+		return fmt.Errorf("event must have 3 fields but %d", len(fields))
+	}
+
+	var ok bool
+	if e.Time, ok = fields[0].(float64); !ok {
+		return fmt.Errorf("invalid event time %v", fields[0])
+	}
+
+	if e.Type, ok = fields[1].(string); !ok {
+		return fmt.Errorf("invalid event type %v", fields[1])
+	}
+
+	if e.Data, ok = fields[2].(string); !ok {
+		return fmt.Errorf("invalid event data %v", fields[2])
+	}
+
+	return nil
+}
+
+// Recorder writes session IO to an asciicast v2 file. All methods are no-op on a nil Recorder.
+type Recorder struct {
+	title       string
+	recordInput bool
+	w           *bufio.Writer
+	file        *os.File
+	start       time.Time
+	guard       sync.Mutex
+	err         error
+
+	// Incomplete UTF-8 sequences at the end of data are written along with the next event of the same type.
+	inputTail  []byte
+	outputTail []byte
+}
+
+// NewRecorder creates the asciicast file. Only output is recorded unless recordInput is set,
+// since input in a terminal may include passwords which are not echoed.
+func NewRecorder(path, title string, recordInput bool) (*Recorder, error) {
+	file, err := os.Create(path)
+	if err != nil {
+		return nil, err
+	}
+
+	return &Recorder{title: title, recordInput: recordInput, w: bufio.NewWriter(file), file: file}, nil
+}
+
+// Begin writes the header. The default terminal size is used if size is nil.
+func (r *Recorder) Begin(size *rpc.TerminalSize) error {
+	if r == nil {
+		return nil
+	}
+
+	header := Header{
+		Version: 2,
+		Width:   defaultWidth,
+		Height:  defaultHeight,
+		Title:   r.title,
+		Env: map[string]string{
+			"SHELL": os.Getenv("SHELL"),
+			"TERM":  os.Getenv("TERM"),
+		},
+	}
+
+	if size != nil {
+		header.Width, header.Height = size.Width, size.Height
+	}
+
+	r.guard.Lock()
+	defer r.guard.Unlock()
+	r.start = time.Now()
+	header.Timestamp = r.start.Unix()
+	return r.writeLine(header)
+}
+
+func (r *Recorder) Output(data []byte) {
+	if r == nil {
+		return
+	}
+
+	r.recordStream("o", &r.outputTail, data)
+}
+
+func (r *Recorder) Input(data []byte) {
+	if r == nil || !r.recordInput {
+		return
+	}
+
+	r.recordStream("i", &r.inputTail, data)
+}
+
+func (r *Recorder) Resize(size *rpc.TerminalSize) {
+	if r == nil || size == nil {
+		return
+	}
+
+	r.guard.Lock()
+	defer r.guard.Unlock()
+	r.writeEvent("r", fmt.Sprintf("%dx%d", size.Width, size.Height))
+}
+
+// recordStream writes data following the tail left by the previous event of the stream,
+// and keeps the incomplete UTF-8 sequence at the end as the new tail.
+func (r *Recorder) recordStream(eventType string, tail *[]byte, data []byte) {
+	r.guard.Lock()
+	defer r.guard.Unlock()
+	data, *tail = splitIncompleteRune(append(*tail, data...))
+	if len(data) > 0 {
+		r.writeEvent(eventType, string(data))
+	}
+}
+
+func (r *Recorder) writeEvent(eventType, data string) {
+	r.writeLine(Event{Time: time.Since(r.start).Seconds(), Type: eventType, Data: data})
+}
+
+// splitIncompleteRune splits the incomplete UTF-8 sequence at the end of data from the complete part.
+// Invalid bytes are regarded as complete runes.
+func splitIncompleteRune(data []byte) (complete, tail []byte) {
+	for i := len(data) - 1; i >= 0 && i >= len(data)-utf8.UTFMax; i-- {
+		if !utf8.RuneStart(data[i]) {
+			continue
+		}
+
+		if utf8.FullRune(data[i:]) {
+			break
+		}
+
+		return data[:i], append([]byte(nil), data[i:]...)
+	}
+
+	return data, nil
+}
+
+func (r *Recorder) writeLine(v interface{}) error {
+	if r.err != nil {
+		return r.err
+	}
+
+	line, err := json.Marshal(v)
+	if err != nil {
+		r.err = err
+		return err
+	}
+
+	if _, err = r.w.Write(append(line, '\n')); err != nil {
+		r.err = err
+	}
+
+	return r.err
+}
+
+// Close flushes all events to the file.
+func (r *Recorder) Close() error {
+	if r == nil {
+		return nil
+	}
+
+	r.guard.Lock()
+	defer r.guard.Unlock()
+	// Incomplete sequences left are written anyway. They are replaced with U+FFFD.
+	if len(r.outputTail) > 0 {
+		r.writeEvent("o", string(r.outputTail))
+	}
+
+	if len(r.inputTail) > 0 {
+		r.writeEvent("i", string(r.inputTail))
+	}
+
+	if err := r.w.Flush(); err != nil {
+		r.file.Close()
+		return err
+	}
+
+	if err := r.file.Close(); err != nil {
+		return err
+	}
+
+	return r.err
+}
+
+// Replay writes output events in the asciicast stream to w following their timing.
+// The timing is scaled by speed, and idle time between events is limited to maxWait if it is positive.
+func Replay(ctx context.Context, r io.Reader, w io.Writer, speed float64, maxWait time.Duration) (*Header, error) {
+	decoder := json.NewDecoder(r)
+	header := &Header{}
+	if err := decoder.Decode(header); err != nil {
+		return nil, fmt.Errorf("invalid asciicast header: %s", err)
+	}
+
+	if header.Version != 2 {
+		return nil, fmt.Errorf("asciicast version %d is not supported", header.Version)
+	}
+
+	if speed <= 0 {
+		speed = 1
+	}
+
+	last := 0.0
+	for {
+		event := Event{}
+		if err := decoder.Decode(&event); err != nil {
+			if err == io.EOF {
+				return header, nil
+			}
+
+			return nil, fmt.Errorf("invalid asciicast event: %s", err)
+		}
+
+		if event.Type != "o" {
+			continue
+		}
+
+		wait := time.Duration((event.Time - last) / speed * float64(time.Second))
+		if maxWait > 0 && wait > maxWait {
+			wait = maxWait
+		}
+
+		last = event.Time
+		select {
+		case <-ctx.Done():
+			return header, nil
+		case <-time.After(wait):
+		}
+
+		if _, err := io.WriteString(w, event.Data); err != nil {
+			return nil, err
+		}
+	}
+}
@@ -0,0 +1,150 @@
+package session
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	rpc "github.com/warm-metal/cliapp/pkg/session"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+	"unicode/utf8"
+)
+
+func TestRecorderRoundTrip(t *testing.T) {
+	tests := []struct {
+		name        string
+		recordInput bool
+		input       [][]byte
+		output      [][]byte
+		events      []string
+		replayed    string
+	}{
+		{
+			name:     "output only by default",
+			input:    [][]byte{[]byte("ls\r"), []byte("secret\r")},
+			output:   [][]byte{[]byte("$ "), []byte("ls\r\nfoo\r\n")},
+			events:   []string{"o:$ ", "o:ls\r\nfoo\r\n"},
+			replayed: "$ ls\r\nfoo\r\n",
+		},
+		{
+			name:        "input recorded if required",
+			recordInput: true,
+			input:       [][]byte{[]byte("ls\r")},
+			output:      [][]byte{[]byte("$ ")},
+			events:      []string{"o:$ ", "i:ls\r"},
+			replayed:    "$ ",
+		},
+		{
+			name:     "multi-byte runes split across events",
+			output:   [][]byte{[]byte("h\xc3"), []byte("\xa9llo \xe4\xb8"), []byte("\x96\xe7"), []byte("\x95\x8c")},
+			events:   []string{"o:h", "o:éllo ", "o:世", "o:界"},
+			replayed: "héllo 世界",
+		},
+		{
+			name:        "multi-byte input split across events",
+			recordInput: true,
+			input:       [][]byte{[]byte("\xe4"), []byte("\xb8"), []byte("\x96")},
+			events:      []string{"i:世"},
+		},
+		{
+			name:     "incomplete tail written while closing",
+			output:   [][]byte{[]byte("a\xe4\xb8")},
+			events:   []string{"o:a", "o:" + strings.Repeat(string(utf8.RuneError), 2)},
+			replayed: "a" + strings.Repeat(string(utf8.RuneError), 2),
+		},
+		{
+			name:     "invalid bytes are not held",
+			output:   [][]byte{[]byte("a\xff"), []byte("b")},
+			events:   []string{"o:a" + string(utf8.RuneError), "o:b"},
+			replayed: "a" + string(utf8.RuneError) + "b",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			path := filepath.Join(t.TempDir(), "session.cast")
+			r, err := NewRecorder(path, "test", tt.recordInput)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			if err = r.Begin(&rpc.TerminalSize{Width: 120, Height: 40}); err != nil {
+				t.Fatal(err)
+			}
+
+			for _, data := range tt.output {
+				r.Output(data)
+			}
+
+			for _, data := range tt.input {
+				r.Input(data)
+			}
+
+			if err = r.Close(); err != nil {
+				t.Fatal(err)
+			}
+
+			cast, err := os.ReadFile(path)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			lines := strings.Split(strings.TrimSuffix(string(cast), "\n"), "\n")
+			var events []string
+			for _, line := range lines[1:] {
+				event := Event{}
+				if err = json.Unmarshal([]byte(line), &event); err != nil {
+					t.Fatalf("invalid event %s: %s", line, err)
+				}
+
+				events = append(events, event.Type+":"+event.Data)
+			}
+
+			if !reflect.DeepEqual(events, tt.events) {
+				t.Errorf("events = %q, want %q", events, tt.events)
+			}
+
+			var replayed bytes.Buffer
+			header, err := Replay(context.TODO(), bytes.NewReader(cast), &replayed, 1000, 0)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			if header.Width != 120 || header.Height != 40 || header.Title != "test" {
+				t.Errorf("header = %+v", header)
+			}
+
+			if replayed.String() != tt.replayed {
+				t.Errorf("replayed = %q, want %q", replayed.String(), tt.replayed)
+			}
+		})
+	}
+}
+
+func TestSplitIncompleteRune(t *testing.T) {
+	tests := []struct {
+		data     string
+		complete string
+		tail     string
+	}{
+		{data: "", complete: "", tail: ""},
+		{data: "abc", complete: "abc", tail: ""},
+		{data: "a\xc3", complete: "a", tail: "\xc3"},
+		{data: "a\xc3\xa9", complete: "a\xc3\xa9", tail: ""},
+		{data: "\xe4\xb8", complete: "", tail: "\xe4\xb8"},
+		{data: "\xf0\x9f\x98", complete: "", tail: "\xf0\x9f\x98"},
+		{data: "\xf0\x9f\x98\x80", complete: "\xf0\x9f\x98\x80", tail: ""},
+		{data: "a\xff", complete: "a\xff", tail: ""},
+		{data: "a\x80\x80\x80\x80", complete: "a\x80\x80\x80\x80", tail: ""},
+	}
+
+	for _, tt := range tests {
+		complete, tail := splitIncompleteRune([]byte(tt.data))
+		if string(complete) != tt.complete || string(tail) != tt.tail {
+			t.Errorf("splitIncompleteRune(%q) = %q, %q, want %q, %q", tt.data, complete, tail, tt.complete, tt.tail)
+		}
+	}
+}
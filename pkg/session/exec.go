@@ -0,0 +1,375 @@
+package session
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"github.com/moby/term"
+	appcorev1 "github.com/warm-metal/cliapp/pkg/apis/cliapp/v1"
+	rpc "github.com/warm-metal/cliapp/pkg/session"
+	"golang.org/x/sys/unix"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+	"io"
+	"k8s.io/client-go/util/exec"
+	"net/url"
+	"os"
+	"os/signal"
+	"strconv"
+	"time"
+)
+
+const (
+	reconnectInterval = 3 * time.Second
+	reconnectTimeout  = 10 * time.Second
+)
+
+// ErrDetached is returned if users type the detach keys.
+var ErrDetached = errors.New("detached from the session")
+
+type options struct {
+	recorder   *Recorder
+	detachKeys []byte
+	reconnect  bool
+}
+
+// Option customizes sessions.
+type Option func(*options)
+
+// WithRecorder records the session.
+func WithRecorder(recorder *Recorder) Option {
+	return func(o *options) {
+		o.recorder = recorder
+	}
+}
+
+// WithDetachKeys closes the session and returns ErrDetached once the key sequence is typed.
+func WithDetachKeys(keys []byte) Option {
+	return func(o *options) {
+		o.detachKeys = keys
+	}
+}
+
+// WithReconnect reopens the session with the same command if the connection is lost, until the context is canceled.
+// The command should attach to a persistent session, e.g., "tmux new-session -A", to get back the same shell.
+func WithReconnect() Option {
+	return func(o *options) {
+		o.reconnect = true
+	}
+}
+
+// connectionLost is the error that the session gate is unreachable or the stream is broken.
+type connectionLost struct {
+	err error
+}
+
+func (e connectionLost) Error() string {
+	return e.err.Error()
+}
+
+func dial(ctx context.Context, endpoints []string) (*grpc.ClientConn, error) {
+	for i, ep := range endpoints {
+		endpoint, err := url.Parse(ep)
+		if err != nil {
+			return nil, fmt.Errorf(`invalid endpoint "%s": %s`, ep, err)
+		}
+
+		cc, err := grpc.DialContext(ctx, endpoint.Host, grpc.WithInsecure(), grpc.WithBlock())
+		if err == nil {
+			return cc, nil
+		}
+
+		fmt.Fprintf(os.Stderr, `can't connect to app session gate "%s": %s`+"\n", endpoint.Host, err)
+		i++
+		if i < len(endpoints) {
+			fmt.Fprintf(os.Stderr, `Try the next endpoint %s`+"\n", endpoints[i])
+		}
+	}
+
+	return nil, fmt.Errorf("all remote endpoints are unavailable")
+}
+
+// shell holds local IO shared by all connections of a session.
+type shell struct {
+	options
+
+	stdout io.Writer
+
+	stdInFd          uintptr
+	stdinIsTerminal  bool
+	stdOutFd         uintptr
+	stdOutIsTerminal bool
+	stdinState       *term.State
+
+	inCh    chan string
+	inErrCh chan error
+	winch   chan os.Signal
+}
+
+// Exec opens a session of the app through one of the session gate endpoints, then runs the command in it.
+// It works like libcli.ExecCliApp, but IO can be hooked, and detaching and reconnecting can be enabled via options.
+// If the remote command fails, an exec.CodeExitError is returned with its exit code.
+func Exec(
+	ctx context.Context, endpoints []string, app *appcorev1.CliApp, args []string, stdin io.Reader, stdout io.Writer,
+	opts ...Option,
+) error {
+	s := &shell{
+		stdout:  stdout,
+		inCh:    make(chan string),
+		inErrCh: make(chan error, 1),
+		winch:   make(chan os.Signal, 1),
+	}
+
+	for _, opt := range opts {
+		opt(&s.options)
+	}
+
+	s.stdInFd, s.stdinIsTerminal = term.GetFdInfo(stdin)
+	s.stdOutFd, s.stdOutIsTerminal = term.GetFdInfo(stdout)
+	if len(s.detachKeys) > 0 {
+		stdin = term.NewEscapeProxy(stdin, s.detachKeys)
+	}
+
+	go func() {
+		defer close(s.inCh)
+
+		buf := make([]byte, 1024)
+		for {
+			n, err := stdin.Read(buf)
+			if n > 0 {
+				s.inCh <- string(buf[:n])
+			}
+
+			if err != nil {
+				if _, detached := err.(term.EscapeError); detached {
+					s.inErrCh <- ErrDetached
+				} else if err != io.EOF {
+					s.inErrCh <- fmt.Errorf("can't read the input:%s", err)
+				}
+
+				return
+			}
+		}
+	}()
+
+	signal.Notify(s.winch, unix.SIGWINCH)
+	defer signal.Stop(s.winch)
+	defer s.restoreTerminal()
+
+	var initTermSize *rpc.TerminalSize
+	if s.stdOutIsTerminal {
+		initTermSize = getSize(s.stdOutFd)
+	}
+
+	if err := s.recorder.Begin(initTermSize); err != nil {
+		return err
+	}
+
+	for reconnecting := false; ; reconnecting = true {
+		err := s.serve(ctx, endpoints, app, args, reconnecting)
+		if _, lost := err.(connectionLost); !lost || !s.reconnect {
+			return err
+		}
+
+		// Restore the terminal such that users can interrupt reconnecting.
+		s.restoreTerminal()
+		fmt.Fprintf(os.Stderr, "\nConnection lost: %s. Reconnecting in %s\n", err, reconnectInterval)
+		select {
+		case <-ctx.Done():
+			return nil
+		case <-time.After(reconnectInterval):
+		}
+	}
+}
+
+func (s *shell) restoreTerminal() {
+	if s.stdinState != nil {
+		term.RestoreTerminal(s.stdInFd, s.stdinState)
+		s.stdinState = nil
+	}
+}
+
+// serve opens a connection to the session gate and forwards IO until the remote command exits or the connection
+// is lost. While reconnecting, dialing times out and the failure is also treated as a lost connection.
+func (s *shell) serve(
+	ctx context.Context, endpoints []string, app *appcorev1.CliApp, args []string, reconnecting bool,
+) error {
+	dialCtx := ctx
+	if reconnecting {
+		var cancelDial context.CancelFunc
+		dialCtx, cancelDial = context.WithTimeout(ctx, reconnectTimeout)
+		defer cancelDial()
+	}
+
+	cc, err := dial(dialCtx, endpoints)
+	if err != nil {
+		if reconnecting && ctx.Err() == nil {
+			return connectionLost{err}
+		}
+
+		return err
+	}
+
+	defer cc.Close()
+
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	sh, err := rpc.NewAppGateClient(cc).OpenShell(ctx)
+	if err != nil {
+		return fmt.Errorf("unable to open app session: %s", err)
+	}
+
+	var initTermSize *rpc.TerminalSize
+	if s.stdOutIsTerminal {
+		initTermSize = getSize(s.stdOutFd)
+	}
+
+	err = sh.Send(&rpc.StdIn{
+		App: &rpc.App{
+			Name:      app.Name,
+			Namespace: app.Namespace,
+		},
+		Input:        args,
+		TerminalSize: initTermSize,
+	})
+	if err != nil {
+		return fmt.Errorf("unable to open app: %s", err)
+	}
+
+	errCh := make(chan error, 1)
+	rawOutCh := make(chan string)
+	go func() {
+		defer close(rawOutCh)
+		for {
+			resp, err := sh.Recv()
+			if err != nil {
+				if err == io.EOF {
+					errCh <- err
+					return
+				}
+
+				st, ok := status.FromError(err)
+				if ok && st.Code() == codes.Aborted {
+					if code, failed := strconv.Atoi(st.Message()); failed == nil {
+						errCh <- exec.CodeExitError{Code: code, Err: err}
+						return
+					}
+				}
+
+				if ok && st.Code() == codes.Unavailable {
+					errCh <- connectionLost{err}
+					return
+				}
+
+				errCh <- fmt.Errorf("can't read the remote response:%s", err)
+				return
+			}
+
+			if len(resp.Output) == 0 {
+				continue
+			}
+
+			if resp.Raw {
+				select {
+				case rawOutCh <- string(resp.Output):
+				case <-ctx.Done():
+					return
+				}
+			} else {
+				fmt.Fprint(s.stdout, string(resp.Output))
+				s.recorder.Output(resp.Output)
+			}
+		}
+	}()
+
+	send := func(in *rpc.StdIn) error {
+		if err := sh.Send(in); err != nil {
+			// The actual error is returned by Recv.
+			if err == io.EOF {
+				return nil
+			}
+
+			return connectionLost{err}
+		}
+
+		return nil
+	}
+
+	inCh := s.inCh
+	for {
+		select {
+		case err := <-errCh:
+			if err == io.EOF {
+				return nil
+			}
+
+			return err
+		case err := <-s.inErrCh:
+			return err
+		case <-s.winch:
+			// Terminal sizes can't be sent any more once the input is closed.
+			if !s.stdOutIsTerminal || inCh == nil {
+				break
+			}
+
+			size := getSize(s.stdOutFd)
+			s.recorder.Resize(size)
+			if err = send(&rpc.StdIn{TerminalSize: size}); err != nil {
+				return err
+			}
+		case <-ctx.Done():
+			return nil
+		case in, ok := <-inCh:
+			if !ok {
+				// Errors are sent before the input channel is closed.
+				select {
+				case err := <-s.inErrCh:
+					return err
+				default:
+				}
+
+				// Half-close the stream such that the remote command also reads EOF from its stdin.
+				inCh = nil
+				if err = sh.CloseSend(); err != nil {
+					return connectionLost{err}
+				}
+
+				break
+			}
+
+			s.recorder.Input([]byte(in))
+			if err = send(&rpc.StdIn{Input: []string{in}}); err != nil {
+				return err
+			}
+		case out, ok := <-rawOutCh:
+			if !ok {
+				rawOutCh = nil
+				break
+			}
+
+			// Once the first stdout received, the shell session is actually opened.
+			// Before that, users also could exit the command by sent an interrupt.
+			if s.stdinIsTerminal && s.stdinState == nil {
+				s.stdinState, err = term.MakeRaw(s.stdInFd)
+				if err != nil {
+					return fmt.Errorf("can't initialize terminal: %s", err)
+				}
+			}
+
+			fmt.Fprint(s.stdout, out)
+			s.recorder.Output([]byte(out))
+		}
+	}
+}
+
+func getSize(fd uintptr) *rpc.TerminalSize {
+	winsize, err := term.GetWinsize(fd)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "unable to get terminal size: %v", err)
+		return nil
+	}
+
+	return &rpc.TerminalSize{Width: uint32(winsize.Width), Height: uint32(winsize.Height)}
+}
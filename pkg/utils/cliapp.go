@@ -0,0 +1,56 @@
+package utils
+
+import (
+	"context"
+	"fmt"
+	appcorev1 "github.com/warm-metal/cliapp/pkg/apis/cliapp/v1"
+	appv1 "github.com/warm-metal/cliapp/pkg/clientset/versioned"
+	"io"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/util/wait"
+	"time"
+)
+
+// AppContainer is the container of app Pods in which sessions run.
+const AppContainer = "workspace"
+
+// appPodTimeout limits the time waiting for an app to be live, including pulling or building its image.
+const appPodTimeout = 5 * time.Minute
+
+// WaitForAppPod waits until the app is live then returns it. Phases of the app are printed to out while waiting.
+// It fails if the app isn't live in 5 minutes.
+func WaitForAppPod(ctx context.Context, appClient appv1.Interface, app *appcorev1.CliApp, out io.Writer) (
+	live *appcorev1.CliApp, err error) {
+	waitCtx, cancel := context.WithTimeout(ctx, appPodTimeout)
+	defer cancel()
+
+	var phase appcorev1.CliAppPhase
+	err = wait.PollImmediateUntil(time.Second, func() (done bool, err error) {
+		live, err = appClient.CliappV1().CliApps(app.Namespace).Get(ctx, app.Name, metav1.GetOptions{})
+		if err != nil {
+			return false, err
+		}
+
+		if len(live.Status.Error) > 0 {
+			return false, fmt.Errorf("app %s failed: %s", app.Name, live.Status.Error)
+		}
+
+		if live.Status.Phase == appcorev1.CliAppPhaseLive && len(live.Status.PodName) > 0 {
+			return true, nil
+		}
+
+		if live.Status.Phase != phase && len(live.Status.Phase) > 0 {
+			phase = live.Status.Phase
+			fmt.Fprintf(out, "Waiting for app %s to be live, currently %s\n", app.Name, phase)
+		}
+
+		return false, nil
+	}, waitCtx.Done())
+
+	if err == wait.ErrWaitTimeout && ctx.Err() == nil {
+		return nil, fmt.Errorf(`app %s isn't live after %s. Run "kubectl dev app doctor -n %s %s" for details`,
+			app.Name, appPodTimeout, app.Namespace, app.Name)
+	}
+
+	return
+}
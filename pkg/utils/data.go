@@ -0,0 +1,52 @@
+package utils
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+)
+
+// ReadDataFromPath reads a local file or all regular files in a local directory as ConfigMap or Secret data.
+// Base names of files are used as keys.
+func ReadDataFromPath(path string) (map[string][]byte, error) {
+	path = ExpandTilde(path)
+	info, err := os.Stat(path)
+	if err != nil {
+		return nil, err
+	}
+
+	if !info.IsDir() {
+		content, err := ioutil.ReadFile(path)
+		if err != nil {
+			return nil, err
+		}
+
+		return map[string][]byte{filepath.Base(path): content}, nil
+	}
+
+	files, err := ioutil.ReadDir(path)
+	if err != nil {
+		return nil, err
+	}
+
+	data := make(map[string][]byte, len(files))
+	for _, file := range files {
+		if !file.Mode().IsRegular() {
+			continue
+		}
+
+		content, err := ioutil.ReadFile(filepath.Join(path, file.Name()))
+		if err != nil {
+			return nil, err
+		}
+
+		data[file.Name()] = content
+	}
+
+	if len(data) == 0 {
+		return nil, fmt.Errorf(`no regular file found in "%s"`, path)
+	}
+
+	return data, nil
+}
@@ -0,0 +1,102 @@
+package utils
+
+import (
+	"fmt"
+	appcorev1 "github.com/warm-metal/cliapp/pkg/apis/cliapp/v1"
+	"github.com/warm-metal/kubectl-dev/pkg/conf"
+	"os"
+	"sort"
+	"strings"
+)
+
+// DistroConfFile is the local configuration in which custom distros are defined.
+const DistroConfFile = "distro"
+
+// Distro describes the context in which debuggers or apps run.
+type Distro struct {
+	// Builtin distro the CliApp declares. Either alpine or ubuntu.
+	Base appcorev1.CliAppDistro `yaml:"base,omitempty"`
+
+	// Context image to run debug sessions instead of the builtin one.
+	ContextImage string `yaml:"image,omitempty"`
+
+	// Package manager in the context to install toolkits.
+	PackageManager string `yaml:"packageManager,omitempty"`
+
+	// Mapping from shell names to their paths in the context.
+	Shells map[string]string `yaml:"shells,omitempty"`
+}
+
+// Builtin context images only provide bash and zsh.
+var builtinDistros = map[string]Distro{
+	string(appcorev1.CliAppDistroAlpine): {
+		Base:           appcorev1.CliAppDistroAlpine,
+		PackageManager: "apk",
+		Shells:         map[string]string{"bash": "bash", "zsh": "zsh"},
+	},
+	string(appcorev1.CliAppDistroUbuntu): {
+		Base:           appcorev1.CliAppDistroUbuntu,
+		PackageManager: "apt",
+		Shells:         map[string]string{"bash": "bash", "zsh": "zsh"},
+	},
+}
+
+// LoadDistros loads builtin distros and custom distros defined in the local configuration.
+func LoadDistros() (map[string]Distro, error) {
+	custom := make(map[string]Distro)
+	if err := conf.Load(DistroConfFile, &custom); err != nil && !os.IsNotExist(err) {
+		return nil, fmt.Errorf("unable to load distros: %s", err)
+	}
+
+	distros := make(map[string]Distro, len(builtinDistros)+len(custom))
+	for name, distro := range custom {
+		if _, found := builtinDistros[string(distro.Base)]; !found {
+			return nil, fmt.Errorf(`base of distro "%s" must be either alpine or ubuntu`, name)
+		}
+
+		distros[strings.ToLower(name)] = distro
+	}
+
+	for name, distro := range builtinDistros {
+		distros[name] = distro
+	}
+
+	return distros, nil
+}
+
+// LookupDistro returns the builtin or custom distro.
+func LookupDistro(name string) (*Distro, error) {
+	distros, err := LoadDistros()
+	if err != nil {
+		return nil, err
+	}
+
+	distro, found := distros[strings.ToLower(name)]
+	if !found {
+		names := make([]string, 0, len(distros))
+		for name := range distros {
+			names = append(names, name)
+		}
+
+		sort.Strings(names)
+		return nil, fmt.Errorf("distro must be one of %v", names)
+	}
+
+	return &distro, nil
+}
+
+// LookupShell returns the path of the shell in the distro.
+func (d *Distro) LookupShell(shell string) (string, error) {
+	path, found := d.Shells[strings.ToLower(shell)]
+	if !found {
+		names := make([]string, 0, len(d.Shells))
+		for name := range d.Shells {
+			names = append(names, name)
+		}
+
+		sort.Strings(names)
+		return "", fmt.Errorf("shell must be one of %v", names)
+	}
+
+	return path, nil
+}
@@ -0,0 +1,105 @@
+package utils
+
+import (
+	appcorev1 "github.com/warm-metal/cliapp/pkg/apis/cliapp/v1"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// setDistroConf writes the distro configuration to a temporary home directory.
+func setDistroConf(t *testing.T, conf string) {
+	home := t.TempDir()
+	t.Setenv("HOME", home)
+	if len(conf) == 0 {
+		return
+	}
+
+	if err := os.MkdirAll(filepath.Join(home, ".kubectl-dev"), 0755); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := ioutil.WriteFile(filepath.Join(home, ".kubectl-dev", DistroConfFile), []byte(conf), 0644); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestLookupDistro(t *testing.T) {
+	setDistroConf(t, `
+Debian:
+  base: ubuntu
+  image: docker.io/library/debian:stable
+  packageManager: apt
+  shells:
+    bash: /bin/bash
+    fish: /usr/bin/fish
+alpine:
+  base: alpine
+  image: docker.io/library/alpine:3.13
+`)
+
+	tests := []struct {
+		name      string
+		distro    string
+		shell     string
+		wantBase  appcorev1.CliAppDistro
+		wantImage string
+		wantShell string
+		wantErr   string
+	}{
+		// The custom alpine doesn't override the builtin one.
+		{name: "builtin", distro: "alpine", shell: "bash", wantBase: appcorev1.CliAppDistroAlpine, wantShell: "bash"},
+		{name: "case insensitive", distro: "Ubuntu", shell: "ZSH", wantBase: appcorev1.CliAppDistroUbuntu,
+			wantShell: "zsh"},
+		{name: "builtin without fish", distro: "alpine", shell: "fish", wantBase: appcorev1.CliAppDistroAlpine,
+			wantErr: "shell must be one of [bash zsh]"},
+		{name: "custom", distro: "debian", shell: "fish", wantBase: appcorev1.CliAppDistroUbuntu,
+			wantImage: "docker.io/library/debian:stable", wantShell: "/usr/bin/fish"},
+		{name: "custom without zsh", distro: "debian", shell: "zsh", wantBase: appcorev1.CliAppDistroUbuntu,
+			wantImage: "docker.io/library/debian:stable", wantErr: "shell must be one of [bash fish]"},
+		{name: "unknown", distro: "centos", wantErr: "distro must be one of [alpine debian ubuntu]"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			distro, err := LookupDistro(tt.distro)
+			if err != nil {
+				if len(tt.wantErr) == 0 || err.Error() != tt.wantErr {
+					t.Fatalf("LookupDistro() error = %v, want %q", err, tt.wantErr)
+				}
+
+				return
+			}
+
+			if distro.Base != tt.wantBase || distro.ContextImage != tt.wantImage {
+				t.Errorf("LookupDistro() = %+v, want base %s and image %q", distro, tt.wantBase, tt.wantImage)
+			}
+
+			shell, err := distro.LookupShell(tt.shell)
+			if err != nil {
+				if len(tt.wantErr) == 0 || err.Error() != tt.wantErr {
+					t.Fatalf("LookupShell() error = %v, want %q", err, tt.wantErr)
+				}
+
+				return
+			}
+
+			if len(tt.wantErr) > 0 || shell != tt.wantShell {
+				t.Errorf("LookupShell() = %q, want %q and error %q", shell, tt.wantShell, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestLoadDistrosWithInvalidBase(t *testing.T) {
+	setDistroConf(t, `
+centos:
+  base: centos
+`)
+
+	if _, err := LoadDistros(); err == nil || !strings.Contains(err.Error(), `"centos"`) {
+		t.Errorf("LoadDistros() error = %v, want the invalid base of centos", err)
+	}
+}
@@ -17,3 +17,12 @@ func ExpandTilde(path string) string {
 
 	return filepath.Join(home, path[1:])
 }
+
+// UserBinDir returns $XDG_BIN_HOME, or ~/.local/bin if not set. Both are writable without sudo.
+func UserBinDir() string {
+	if dir := os.Getenv("XDG_BIN_HOME"); len(dir) > 0 {
+		return dir
+	}
+
+	return "~/.local/bin"
+}
@@ -0,0 +1,138 @@
+package utils
+
+import (
+	"context"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/resource"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/fields"
+	"k8s.io/client-go/kubernetes"
+)
+
+// RequireNode adds the requirement of scheduling Pods on the node to the affinity, and returns the affinity.
+// Other node requirements are kept. A new affinity is returned if the given one is nil.
+func RequireNode(affinity *corev1.Affinity, node string) *corev1.Affinity {
+	if affinity == nil {
+		affinity = &corev1.Affinity{}
+	}
+
+	if affinity.NodeAffinity == nil {
+		affinity.NodeAffinity = &corev1.NodeAffinity{}
+	}
+
+	requirement := corev1.NodeSelectorRequirement{
+		Key:      "metadata.name",
+		Operator: corev1.NodeSelectorOpIn,
+		Values:   []string{node},
+	}
+
+	required := affinity.NodeAffinity.RequiredDuringSchedulingIgnoredDuringExecution
+	if required == nil || len(required.NodeSelectorTerms) == 0 {
+		affinity.NodeAffinity.RequiredDuringSchedulingIgnoredDuringExecution = &corev1.NodeSelector{
+			NodeSelectorTerms: []corev1.NodeSelectorTerm{{
+				MatchFields: []corev1.NodeSelectorRequirement{requirement},
+			}},
+		}
+
+		return affinity
+	}
+
+	// Terms are ORed while requirements in a term are ANDed. So, the node is required in every term.
+	for i := range required.NodeSelectorTerms {
+		term := &required.NodeSelectorTerms[i]
+		term.MatchFields = append(term.MatchFields, requirement)
+	}
+
+	return affinity
+}
+
+// GetPodRequests returns the resources a Pod requests. It is the larger one between the sum of all containers and
+// the maximum of init containers.
+func GetPodRequests(spec *corev1.PodSpec) corev1.ResourceList {
+	requests := corev1.ResourceList{}
+	for _, c := range spec.Containers {
+		for name, quantity := range c.Resources.Requests {
+			sum := requests[name]
+			sum.Add(quantity)
+			requests[name] = sum
+		}
+	}
+
+	for _, c := range spec.InitContainers {
+		for name, quantity := range c.Resources.Requests {
+			if current, found := requests[name]; !found || quantity.Cmp(current) > 0 {
+				requests[name] = quantity.DeepCopy()
+			}
+		}
+	}
+
+	return requests
+}
+
+// GetNodeFreeResources returns allocatable resources of the node minus requests of all non-terminated Pods on it.
+func GetNodeFreeResources(ctx context.Context, clientset *kubernetes.Clientset, node *corev1.Node) (corev1.ResourceList, error) {
+	pods, err := clientset.CoreV1().Pods(metav1.NamespaceAll).List(ctx, metav1.ListOptions{
+		FieldSelector: fields.AndSelectors(
+			fields.OneTermEqualSelector("spec.nodeName", node.Name),
+			fields.OneTermNotEqualSelector("status.phase", string(corev1.PodSucceeded)),
+			fields.OneTermNotEqualSelector("status.phase", string(corev1.PodFailed)),
+		).String(),
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	free := node.Status.Allocatable.DeepCopy()
+	for i := range pods.Items {
+		for name, quantity := range GetPodRequests(&pods.Items[i].Spec) {
+			if left, found := free[name]; found {
+				left.Sub(quantity)
+				free[name] = left
+			}
+		}
+	}
+
+	return free, nil
+}
+
+// GetInsufficientResources returns resources of which the requested quantity exceeds the free one.
+func GetInsufficientResources(requests, free corev1.ResourceList) []corev1.ResourceName {
+	var insufficient []corev1.ResourceName
+	for name, quantity := range requests {
+		left, found := free[name]
+		if !found {
+			left = resource.Quantity{}
+		}
+
+		if quantity.Cmp(left) > 0 {
+			insufficient = append(insufficient, name)
+		}
+	}
+
+	return insufficient
+}
+
+// GetUntoleratedTaints returns NoSchedule and NoExecute taints which are not tolerated by any of the tolerations.
+func GetUntoleratedTaints(taints []corev1.Taint, tolerations []corev1.Toleration) []corev1.Taint {
+	var untolerated []corev1.Taint
+	for i := range taints {
+		taint := &taints[i]
+		if taint.Effect == corev1.TaintEffectPreferNoSchedule {
+			continue
+		}
+
+		tolerated := false
+		for j := range tolerations {
+			if tolerations[j].ToleratesTaint(taint) {
+				tolerated = true
+				break
+			}
+		}
+
+		if !tolerated {
+			untolerated = append(untolerated, *taint)
+		}
+	}
+
+	return untolerated
+}
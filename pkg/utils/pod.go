@@ -42,3 +42,46 @@ func GetPodConditionFromList(conditions []corev1.PodCondition, conditionType cor
 	}
 	return -1, nil
 }
+
+// GetAbnormalContainerStatuses returns statuses of init and regular containers which are waiting to restart or
+// terminated with failures.
+func GetAbnormalContainerStatuses(status corev1.PodStatus) []corev1.ContainerStatus {
+	var abnormal []corev1.ContainerStatus
+	for _, statuses := range [][]corev1.ContainerStatus{status.InitContainerStatuses, status.ContainerStatuses} {
+		for i := range statuses {
+			if IsContainerAbnormal(&statuses[i]) {
+				abnormal = append(abnormal, statuses[i])
+			}
+		}
+	}
+
+	return abnormal
+}
+
+// IsContainerAbnormal returns true if the container is waiting for reasons other than creating or initializing,
+// or it is terminated with a non-zero exit code.
+func IsContainerAbnormal(status *corev1.ContainerStatus) bool {
+	if status.State.Waiting != nil {
+		switch status.State.Waiting.Reason {
+		case "", "ContainerCreating", "PodInitializing":
+			return status.RestartCount > 0
+		default:
+			return true
+		}
+	}
+
+	if status.State.Terminated != nil {
+		return status.State.Terminated.ExitCode != 0
+	}
+
+	return false
+}
+
+// GetLastTermination returns the current termination state if the container is terminated, or the last one.
+func GetLastTermination(status *corev1.ContainerStatus) *corev1.ContainerStateTerminated {
+	if status.State.Terminated != nil {
+		return status.State.Terminated
+	}
+
+	return status.LastTerminationState.Terminated
+}
@@ -0,0 +1,42 @@
+package utils
+
+import (
+	corev1 "k8s.io/api/core/v1"
+	"testing"
+)
+
+func TestIsContainerAbnormal(t *testing.T) {
+	waiting := func(reason string) corev1.ContainerState {
+		return corev1.ContainerState{Waiting: &corev1.ContainerStateWaiting{Reason: reason}}
+	}
+
+	terminated := func(code int32) corev1.ContainerState {
+		return corev1.ContainerState{Terminated: &corev1.ContainerStateTerminated{ExitCode: code}}
+	}
+
+	tests := []struct {
+		name     string
+		state    corev1.ContainerState
+		restarts int32
+		want     bool
+	}{
+		{name: "running", state: corev1.ContainerState{Running: &corev1.ContainerStateRunning{}}},
+		{name: "creating", state: waiting("ContainerCreating")},
+		{name: "initializing", state: waiting("PodInitializing")},
+		{name: "creating after restarts", state: waiting("ContainerCreating"), restarts: 1, want: true},
+		{name: "crash looping", state: waiting("CrashLoopBackOff"), restarts: 3, want: true},
+		{name: "image pull failure", state: waiting("ImagePullBackOff"), want: true},
+		{name: "config error", state: waiting("CreateContainerConfigError"), want: true},
+		{name: "completed", state: terminated(0)},
+		{name: "failed", state: terminated(1), want: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			status := &corev1.ContainerStatus{State: tt.state, RestartCount: tt.restarts}
+			if got := IsContainerAbnormal(status); got != tt.want {
+				t.Errorf("IsContainerAbnormal() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,67 @@
+package utils
+
+import (
+	"bufio"
+	"fmt"
+	"github.com/moby/term"
+	"io"
+	"strconv"
+	"strings"
+)
+
+// IsTerminal returns true if the stream is a terminal.
+func IsTerminal(stream interface{}) bool {
+	_, isTerminal := term.GetFdInfo(stream)
+	return isTerminal
+}
+
+// Choose prints all options and reads the index of the option the user chooses.
+func Choose(in io.Reader, out io.Writer, prompt string, options []string) (int, error) {
+	if len(options) == 0 {
+		return -1, fmt.Errorf("nothing to choose")
+	}
+
+	if !IsTerminal(in) {
+		return -1, fmt.Errorf("%s. Options are\n  %s", prompt, strings.Join(options, "\n  "))
+	}
+
+	for i, option := range options {
+		fmt.Fprintf(out, "[%d] %s\n", i, option)
+	}
+
+	reader := bufio.NewReader(in)
+	for {
+		fmt.Fprintf(out, "%s [0-%d]: ", prompt, len(options)-1)
+		line, err := reader.ReadString('\n')
+		if err != nil {
+			return -1, err
+		}
+
+		i, err := strconv.Atoi(strings.TrimSpace(line))
+		if err == nil && i >= 0 && i < len(options) {
+			return i, nil
+		}
+
+		fmt.Fprintf(out, "Invalid choice %q\n", strings.TrimSpace(line))
+	}
+}
+
+// Confirm asks users to confirm by typing "y" or "yes". It fails if the input isn't a terminal.
+func Confirm(in io.Reader, out io.Writer, prompt string) (bool, error) {
+	if !IsTerminal(in) {
+		return false, fmt.Errorf("%s. Confirmation is required in a terminal", prompt)
+	}
+
+	fmt.Fprintf(out, "%s [y/N]: ", prompt)
+	line, err := bufio.NewReader(in).ReadString('\n')
+	if err != nil {
+		return false, err
+	}
+
+	switch strings.ToLower(strings.TrimSpace(line)) {
+	case "y", "yes":
+		return true, nil
+	default:
+		return false, nil
+	}
+}
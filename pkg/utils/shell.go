@@ -0,0 +1,23 @@
+package utils
+
+import (
+	"regexp"
+	"strings"
+)
+
+var shellSafe = regexp.MustCompile(`^[a-zA-Z0-9_@%+=:,./-]+$`)
+
+// ShellQuote joins args to a command line which can be passed to a POSIX shell as is.
+func ShellQuote(args ...string) string {
+	quoted := make([]string, len(args))
+	for i, arg := range args {
+		if shellSafe.MatchString(arg) {
+			quoted[i] = arg
+			continue
+		}
+
+		quoted[i] = "'" + strings.Replace(arg, "'", `'"'"'`, -1) + "'"
+	}
+
+	return strings.Join(quoted, " ")
+}
@@ -0,0 +1,50 @@
+package utils
+
+import (
+	"os/exec"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestShellQuote(t *testing.T) {
+	tests := []struct {
+		name string
+		args []string
+		want string
+	}{
+		{name: "safe", args: []string{"ls", "-l", "/tmp/a_b.c", "k=v,w@x:y%z+"}, want: "ls -l /tmp/a_b.c k=v,w@x:y%z+"},
+		{name: "empty", args: []string{"echo", ""}, want: "echo ''"},
+		{name: "spaces", args: []string{"echo", "a b"}, want: "echo 'a b'"},
+		{name: "single quotes", args: []string{"echo", "it's"}, want: `echo 'it'"'"'s'`},
+		{name: "expansions", args: []string{"echo", "$HOME", "`id`", "*"}, want: "echo '$HOME' '`id`' '*'"},
+		{name: "newline", args: []string{"sh", "-c", "a\nb"}, want: "sh -c 'a\nb'"},
+		{name: "no args", want: ""},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := ShellQuote(tt.args...); got != tt.want {
+				t.Errorf("ShellQuote() = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestShellQuoteRoundTrip(t *testing.T) {
+	sh, err := exec.LookPath("sh")
+	if err != nil {
+		t.Skip("sh not found")
+	}
+
+	args := []string{"", "a b", "it's", "$HOME", "`id`", "*", "a\nb", `"quoted"`, `back\slash`, "; echo injected"}
+	// sh must parse the quoted command line back to the same args.
+	out, err := exec.Command(sh, "-c", `printf '%s\0' `+ShellQuote(args...)).Output()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if got := strings.Split(strings.TrimSuffix(string(out), "\x00"), "\x00"); !reflect.DeepEqual(got, args) {
+		t.Errorf("args parsed by sh = %q, want %q", got, args)
+	}
+}
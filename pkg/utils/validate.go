@@ -6,14 +6,14 @@ import (
 	"strings"
 )
 
+// ValidateDistro returns the builtin distro the CliApp declares. Custom distros are mapped to their bases.
 func ValidateDistro(distro string) (appcorev1.CliAppDistro, error) {
-	appDistro := appcorev1.CliAppDistro(strings.ToLower(distro))
-	switch appDistro {
-	case appcorev1.CliAppDistroAlpine, appcorev1.CliAppDistroUbuntu:
-		return appDistro, nil
-	default:
-		return "", fmt.Errorf("distro must be either alpine or ubuntu.")
+	d, err := LookupDistro(distro)
+	if err != nil {
+		return "", err
 	}
+
+	return d.Base, nil
 }
 
 func ValidateShell(shell string) (appcorev1.CliAppShell, error) {
@@ -22,6 +22,6 @@ func ValidateShell(shell string) (appcorev1.CliAppShell, error) {
 	case appcorev1.CliAppShellBash, appcorev1.CliAppShellZsh:
 		return appShell, nil
 	default:
-		return "", fmt.Errorf("distro must be either bash or zsh.")
+		return "", fmt.Errorf("shell must be either bash or zsh.")
 	}
 }
@@ -0,0 +1,228 @@
+package utils
+
+import (
+	"context"
+	"fmt"
+	appsv1 "k8s.io/api/apps/v1"
+	batchv1 "k8s.io/api/batch/v1"
+	batchv1beta1 "k8s.io/api/batch/v1beta1"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/meta"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/cli-runtime/pkg/genericclioptions"
+	"k8s.io/cli-runtime/pkg/resource"
+	"k8s.io/client-go/kubernetes"
+	"k8s.io/client-go/kubernetes/scheme"
+)
+
+// Workload is the object a debugger forks. Pod is set only if the object is a Pod.
+type Workload struct {
+	Kind      string
+	Name      string
+	Namespace string
+	UID       types.UID
+	Template  *corev1.PodTemplateSpec
+	Pod       *corev1.Pod
+
+	// Selector is the label selector in the spec of the workload. It is nil for CronJobs and Pods.
+	Selector *metav1.LabelSelector
+}
+
+// ListPods returns Pods controlled by the workload, or by ReplicaSets or Jobs the workload controls.
+// Pods matching the selector but controlled by other objects are excluded.
+func (w *Workload) ListPods(ctx context.Context, clientset kubernetes.Interface) ([]corev1.Pod, error) {
+	switch w.Kind {
+	case "Pod":
+		return []corev1.Pod{*w.Pod}, nil
+	case "Deployment":
+		selector, err := w.selector(w.Selector)
+		if err != nil {
+			return nil, err
+		}
+
+		replicaSets, err := clientset.AppsV1().ReplicaSets(w.Namespace).List(ctx, metav1.ListOptions{
+			LabelSelector: selector,
+		})
+		if err != nil {
+			return nil, err
+		}
+
+		var owners []types.UID
+		for i := range replicaSets.Items {
+			if isControlledBy(&replicaSets.Items[i], w.UID) {
+				owners = append(owners, replicaSets.Items[i].UID)
+			}
+		}
+
+		return w.listControlledPods(ctx, clientset, selector, owners...)
+	case "CronJob":
+		jobs, err := clientset.BatchV1().Jobs(w.Namespace).List(ctx, metav1.ListOptions{})
+		if err != nil {
+			return nil, err
+		}
+
+		var pods []corev1.Pod
+		for i := range jobs.Items {
+			job := &jobs.Items[i]
+			if !isControlledBy(job, w.UID) {
+				continue
+			}
+
+			selector, err := w.selector(job.Spec.Selector)
+			if err != nil {
+				return nil, err
+			}
+
+			jobPods, err := w.listControlledPods(ctx, clientset, selector, job.UID)
+			if err != nil {
+				return nil, err
+			}
+
+			pods = append(pods, jobPods...)
+		}
+
+		return pods, nil
+	default:
+		selector, err := w.selector(w.Selector)
+		if err != nil {
+			return nil, err
+		}
+
+		return w.listControlledPods(ctx, clientset, selector, w.UID)
+	}
+}
+
+// selector converts the label selector of the workload. Empty selectors are refused since they match all Pods.
+func (w *Workload) selector(labelSelector *metav1.LabelSelector) (string, error) {
+	selector, err := metav1.LabelSelectorAsSelector(labelSelector)
+	if err != nil {
+		return "", fmt.Errorf("invalid selector of %s/%s: %s", w.Kind, w.Name, err)
+	}
+
+	if selector.Empty() {
+		return "", fmt.Errorf("the selector of %s/%s is empty", w.Kind, w.Name)
+	}
+
+	return selector.String(), nil
+}
+
+// listControlledPods returns Pods matching the selector and controlled by one of the owners.
+func (w *Workload) listControlledPods(
+	ctx context.Context, clientset kubernetes.Interface, selector string, owners ...types.UID,
+) ([]corev1.Pod, error) {
+	if len(owners) == 0 {
+		return nil, nil
+	}
+
+	list, err := clientset.CoreV1().Pods(w.Namespace).List(ctx, metav1.ListOptions{LabelSelector: selector})
+	if err != nil {
+		return nil, err
+	}
+
+	var pods []corev1.Pod
+	for i := range list.Items {
+		for _, owner := range owners {
+			if isControlledBy(&list.Items[i], owner) {
+				pods = append(pods, list.Items[i])
+				break
+			}
+		}
+	}
+
+	return pods, nil
+}
+
+func isControlledBy(obj metav1.Object, owner types.UID) bool {
+	ref := metav1.GetControllerOf(obj)
+	return ref != nil && ref.UID == owner
+}
+
+// FetchWorkload fetches the object in the form of "kind/name" and extracts its Pod template.
+// Deployment, StatefulSet, DaemonSet, ReplicaSet, Job, CronJob, and Pod are supported.
+func FetchWorkload(getter genericclioptions.RESTClientGetter, namespace, object string) (*Workload, error) {
+	obj, err := resource.NewBuilder(getter).
+		WithScheme(scheme.Scheme, scheme.Scheme.PrioritizedVersionsAllGroups()...).
+		NamespaceParam(namespace).DefaultNamespace().
+		ResourceTypeOrNameArgs(true, object).
+		SingleResourceType().
+		Flatten().
+		Do().
+		Object()
+	if err != nil {
+		return nil, fmt.Errorf(`unable to fetch "%s": %s`, object, err)
+	}
+
+	w := &Workload{}
+	switch o := obj.(type) {
+	case *appsv1.Deployment:
+		w.Kind, w.Template, w.Selector = "Deployment", &o.Spec.Template, o.Spec.Selector
+	case *appsv1.StatefulSet:
+		w.Kind, w.Template, w.Selector = "StatefulSet", &o.Spec.Template, o.Spec.Selector
+	case *appsv1.DaemonSet:
+		w.Kind, w.Template, w.Selector = "DaemonSet", &o.Spec.Template, o.Spec.Selector
+	case *appsv1.ReplicaSet:
+		w.Kind, w.Template, w.Selector = "ReplicaSet", &o.Spec.Template, o.Spec.Selector
+	case *batchv1.Job:
+		w.Kind, w.Template, w.Selector = "Job", &o.Spec.Template, o.Spec.Selector
+	case *batchv1.CronJob:
+		w.Kind, w.Template = "CronJob", &o.Spec.JobTemplate.Spec.Template
+	case *batchv1beta1.CronJob:
+		w.Kind, w.Template = "CronJob", &o.Spec.JobTemplate.Spec.Template
+	case *corev1.Pod:
+		w.Kind, w.Pod = "Pod", o
+		w.Template = &corev1.PodTemplateSpec{ObjectMeta: o.ObjectMeta, Spec: o.Spec}
+	default:
+		return nil, fmt.Errorf(`object "%s" is not supported`, object)
+	}
+
+	accessor, err := meta.Accessor(obj)
+	if err != nil {
+		return nil, err
+	}
+
+	w.Name, w.Namespace, w.UID = accessor.GetName(), accessor.GetNamespace(), accessor.GetUID()
+
+	return w, nil
+}
+
+// FindContainer returns the container in the Pod spec. If name is empty, the only container is returned.
+func FindContainer(spec *corev1.PodSpec, name string) (*corev1.Container, error) {
+	if len(name) == 0 {
+		if len(spec.Containers) == 1 {
+			return &spec.Containers[0], nil
+		}
+
+		return nil, fmt.Errorf("more than 1 container found. Specify one of %v", ContainerNames(spec.Containers))
+	}
+
+	for i := range spec.Containers {
+		if spec.Containers[i].Name == name {
+			return &spec.Containers[i], nil
+		}
+	}
+
+	return nil, fmt.Errorf("container %s not found", name)
+}
+
+// FindContainerOrInitContainer returns the regular or init container in the Pod spec. init is true if the container
+// is an init container.
+func FindContainerOrInitContainer(spec *corev1.PodSpec, name string) (container *corev1.Container, init bool, err error) {
+	for i := range spec.InitContainers {
+		if len(name) > 0 && spec.InitContainers[i].Name == name {
+			return &spec.InitContainers[i], true, nil
+		}
+	}
+
+	container, err = FindContainer(spec, name)
+	return container, false, err
+}
+
+func ContainerNames(containers []corev1.Container) []string {
+	names := make([]string, len(containers))
+	for i := range containers {
+		names[i] = containers[i].Name
+	}
+
+	return names
+}